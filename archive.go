@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compressedExtensions are the kinds of file that deflate cannot shrink
+// any further, so they are stored as they are.
+var compressedExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".m4a": true, ".ogg": true, ".mp4": true, ".mov": true, ".webm": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".7z": true,
+	".docx": true, ".xlsx": true, ".pptx": true,
+}
+
+// archiveAttempts is how many times the archive is written before giving
+// up, since a network mount or a virus scanner holding a file can make one
+// attempt fail.
+const archiveAttempts = 3
+
+// archive zips up dir into slackdump.zip in the working directory, with
+// everything under a top-level folder named after dir. Files are deflated
+// at the given level, except for already compressed ones. When splitSize is
+// set and the archive is bigger, it is cut into parts of that many bytes,
+// slackdump.zip.001, slackdump.zip.002 and so on, which put back together
+// make slackdump.zip again. When out is set, the archive is written to it
+// instead, in one attempt since what was sent cannot be taken back. When it
+// cannot be written, dir is left as it is and the run ends saying where it
+// is, so the dump is not lost.
+func archive(dir string, level int, splitSize int64, out io.Writer) {
+	attempts := archiveAttempts
+	if out != nil {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if out != nil {
+			err = writeZip(out, dir, level)
+		} else {
+			err = writeArchive(dir, level, splitSize)
+		}
+		if err == nil {
+			return
+		}
+		if attempt < attempts {
+			delay := time.Duration(attempt) * 5 * time.Second
+			logf("WARNING: could not write the archive (%v), trying again in %s", err, delay)
+			time.Sleep(delay)
+		}
+	}
+	logf("ERROR: could not write the archive: %v", err)
+	logf("ERROR: the dumped files are left in %s", dir)
+	os.Exit(exitFilesystem)
+}
+
+// writeArchive makes one attempt at writing the archive.
+func writeArchive(dir string, level int, splitSize int64) error {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	name := path.Join(pwd, "slackdump.zip")
+	var f io.WriteCloser
+	var parts *splitWriter
+	if splitSize > 0 {
+		// Parts left by an earlier, bigger archive would be joined onto this one.
+		old, err := filepath.Glob(name + ".[0-9][0-9][0-9]")
+		if err != nil {
+			return err
+		}
+		for _, p := range old {
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+		}
+		// And a whole archive left by an earlier run would be taken for
+		// this one, or for part of it.
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		parts = &splitWriter{name: name, size: splitSize}
+		f = parts
+	} else {
+		f, err = os.Create(name)
+		if err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+
+	if err := writeZip(f, dir, level); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if parts != nil && parts.count == 1 {
+		return os.Rename(parts.partName(1), name)
+	}
+	if parts != nil {
+		logf("archive split into %d parts: %s.001 to %s", parts.count, filepath.Base(name), filepath.Base(parts.partName(parts.count)))
+	}
+	return nil
+}
+
+// writeZip writes the zip of dir to out.
+func writeZip(out io.Writer, dir string, level int) error {
+	w := zip.NewWriter(out)
+	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(filepath.Join(filepath.Base(dir), rel))
+		header.Method = zip.Deflate
+		if level == 0 || compressedExtensions[strings.ToLower(filepath.Ext(p))] {
+			header.Method = zip.Store
+		}
+
+		entry, err := w.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(entry, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// splitWriter writes a file as numbered parts of at most size bytes each.
+type splitWriter struct {
+	name  string
+	size  int64
+	count int
+
+	part    *os.File
+	written int64
+}
+
+func (s *splitWriter) partName(n int) string {
+	return fmt.Sprintf("%s.%03d", s.name, n)
+}
+
+func (s *splitWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if s.part == nil || s.written == s.size {
+			if err := s.Close(); err != nil {
+				return total, err
+			}
+			s.count++
+			part, err := os.Create(s.partName(s.count))
+			if err != nil {
+				return total, err
+			}
+			s.part, s.written = part, 0
+		}
+
+		chunk := p
+		if room := s.size - s.written; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := s.part.Write(chunk)
+		total += n
+		s.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close closes the part being written. Closing again does nothing.
+func (s *splitWriter) Close() error {
+	if s.part == nil {
+		return nil
+	}
+	err := s.part.Close()
+	s.part = nil
+	return err
+}
+
+// parseSize reads a size such as 500MB, 2GB or 1GiB. The decimal units
+// count in powers of 1000 and the binary ones in powers of 1024; a plain
+// number is bytes.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		bytes  int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+		{"B", 1},
+	}
+	number, multiplier := strings.TrimSpace(s), int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(strings.ToUpper(number), strings.ToUpper(unit.suffix)) {
+			number = strings.TrimSpace(number[:len(number)-len(unit.suffix)])
+			multiplier = unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a size", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// blocksText flattens the Block Kit blocks of a message into mrkdwn text,
+// one block per line, for the renderers. Apps often post their messages as
+// blocks only, with no text. Section texts and fields, context elements,
+// button labels and image titles are kept; a divider becomes a line of
+// dashes, and the rest is left out.
+func blocksText(blocks slack.Blocks) string {
+	var lines []string
+	add := func(text string) {
+		if text = strings.TrimSpace(text); text != "" {
+			lines = append(lines, text)
+		}
+	}
+
+	for _, block := range blocks.BlockSet {
+		switch b := block.(type) {
+		case *slack.SectionBlock:
+			add(blockObjectText(b.Text))
+			for _, field := range b.Fields {
+				add(blockObjectText(field))
+			}
+		case *slack.ContextBlock:
+			var parts []string
+			for _, element := range b.ContextElements.Elements {
+				switch e := element.(type) {
+				case *slack.TextBlockObject:
+					parts = append(parts, blockObjectText(e))
+				case *slack.ImageBlockElement:
+					parts = append(parts, escapeEntities(e.AltText))
+				}
+			}
+			add(strings.Join(parts, " "))
+		case *slack.ActionBlock:
+			var labels []string
+			for _, element := range b.Elements.ElementSet {
+				if button, ok := element.(*slack.ButtonBlockElement); ok && button.Text != nil {
+					labels = append(labels, "["+blockObjectText(button.Text)+"]")
+				}
+			}
+			add(strings.Join(labels, " "))
+		case *slack.ImageBlock:
+			if b.Title != nil {
+				add(blockObjectText(b.Title))
+			} else {
+				add(escapeEntities(b.AltText))
+			}
+		case *slack.DividerBlock:
+			lines = append(lines, "---")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeEntities escapes text the way Slack escapes mrkdwn text.
+var escapeEntities = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+// blockObjectText returns the text of object as mrkdwn. Slack escapes
+// mrkdwn objects but not plain_text ones, which are escaped here.
+func blockObjectText(object *slack.TextBlockObject) string {
+	if object == nil {
+		return ""
+	}
+	if object.Type == "mrkdwn" {
+		return object.Text
+	}
+	return escapeEntities(object.Text)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// defaultAPIURL is where the Slack Web API lives unless --api-url says
+// otherwise.
+const defaultAPIURL = "https://slack.com/api/"
+
+// channelKnowledge is what a channel keeps besides its messages, as saved
+// in its bookmarks file. Both parts are kept as Slack sent them.
+type channelKnowledge struct {
+	Bookmarks []json.RawMessage `json:"bookmarks"`
+	Canvas    json.RawMessage   `json:"canvas,omitempty"`
+}
+
+// writeBookmarks saves the bookmarks and the canvas reference of a
+// conversation as <filename>.bookmarks.json. The slack package has no calls
+// for either, so the Web API is asked directly. A workspace or token that
+// does not allow them is reported as a warning.
+func writeBookmarks(dir string, channelPath string, meta *ChannelMeta, opts *options) {
+	var knowledge channelKnowledge
+
+	var list struct {
+		Bookmarks []json.RawMessage `json:"bookmarks"`
+	}
+	sleepBeforeFetchIfNeeded()
+	if err := callAPI(opts, "bookmarks.list", url.Values{"channel_id": {meta.ID}}, &list); err != nil {
+		addWarning("could not get the bookmarks of %s: %v", meta.Name, err)
+		return
+	}
+	knowledge.Bookmarks = list.Bookmarks
+
+	var info struct {
+		Channel struct {
+			Properties struct {
+				Canvas json.RawMessage `json:"canvas"`
+			} `json:"properties"`
+		} `json:"channel"`
+	}
+	sleepBeforeFetchIfNeeded()
+	if err := callAPI(opts, "conversations.info", url.Values{"channel": {meta.ID}}, &info); err != nil {
+		addWarning("could not get the canvas of %s: %v", meta.Name, err)
+	}
+	knowledge.Canvas = info.Channel.Properties.Canvas
+
+	if len(knowledge.Bookmarks) == 0 && len(knowledge.Canvas) == 0 {
+		return
+	}
+
+	channelDir, filename := sideFiles(dir, channelPath, meta, opts)
+	data, err := MarshalIndent(knowledge, "", "    ")
+	check(err)
+	err = writeFileIfChanged(path.Join(channelDir, filename+".bookmarks.json"), data)
+	check(err)
+}
+
+// callAPI posts params to a Web API method and decodes the response into v.
+// A response that is not ok is returned as an error holding Slack's reason.
+func callAPI(opts *options, method string, params url.Values, v interface{}) error {
+	req, err := http.NewRequest("POST", opts.apiURL+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+opts.token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Transport: withTokenRefresh(retryingTransport{countingTransport{baseTransport}})}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return fmt.Errorf("%s", status.Error)
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// isBotToken reports whether opts.token is the token of a bot rather than a
+// user's. Bot tokens begin with xoxb-, and auth.test gives bots a bot_id,
+// which the slack package does not decode, so the Web API is asked directly.
+func isBotToken(opts *options) bool {
+	if strings.HasPrefix(opts.token, "xoxb-") {
+		return true
+	}
+	var auth struct {
+		BotID string `json:"bot_id"`
+	}
+	if err := callAPI(opts, "auth.test", url.Values{}, &auth); err != nil {
+		return false
+	}
+	return auth.BotID != ""
+}
+
+// joinChannels makes the bot a member of each of channels it is not in yet,
+// as a bot cannot read the history of the others. The channels it could not
+// join are left out with a warning.
+func joinChannels(api *slack.Client, channels []slack.Channel) []slack.Channel {
+	var joined []slack.Channel
+	for _, channel := range channels {
+		if !channel.IsMember {
+			sleepBeforeFetchIfNeeded()
+			if _, _, _, err := api.JoinConversation(channel.ID); err != nil {
+				addWarning("the bot could not join %s: %v", channel.Name, err)
+				continue
+			}
+			logWith(logFields{"channel": channel.Name}, "  joined %s", channel.Name)
+		}
+		joined = append(joined, channel)
+	}
+	return joined
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// callSubtypes are the subtypes of the messages Slack posts for calls and
+// huddles.
+var callSubtypes = map[string]bool{
+	"sh_room_created": true,
+	"sh_room_shared":  true,
+	"huddle_thread":   true,
+}
+
+// callRoom is the call or huddle a call message is about, as Slack sends it
+// in the message's room field.
+type callRoom struct {
+	CreatedBy          string   `json:"created_by"`
+	DateStart          int64    `json:"date_start"`
+	DateEnd            int64    `json:"date_end"`
+	Participants       []string `json:"participants"`
+	ParticipantHistory []string `json:"participant_history"`
+}
+
+// callRooms holds the rooms of the call messages looked up so far, by
+// callRoomKey: a ts is only unique within its conversation.
+var callRooms = map[string]*callRoom{}
+var callRoomsMutex sync.Mutex
+
+// callRoomKey is the key in callRooms of the call message at ts in meta.
+func callRoomKey(meta *ChannelMeta, ts string) string {
+	return meta.ID + "/" + ts
+}
+
+// fetchCallRooms looks up the rooms of the call messages of a
+// conversation. The slack package leaves the room field out of the messages
+// it hands over, so each call message is fetched again, one API call each.
+// A room that cannot be had is left out, and its message shows less.
+func fetchCallRooms(messages []slack.Message, meta *ChannelMeta, opts *options) {
+	for _, msg := range messages {
+		if !callSubtypes[msg.SubType] {
+			continue
+		}
+
+		var history struct {
+			Messages []struct {
+				Room *callRoom `json:"room"`
+			} `json:"messages"`
+		}
+		params := url.Values{
+			"channel":   {meta.ID},
+			"latest":    {msg.Timestamp},
+			"inclusive": {"true"},
+			"limit":     {"1"},
+		}
+		sleepBeforeFetchIfNeeded()
+		if err := callAPI(opts, "conversations.history", params, &history); err != nil {
+			logf("  could not get the call of message %s in %s: %v", msg.Timestamp, meta.Name, err)
+			continue
+		}
+		if len(history.Messages) == 1 && history.Messages[0].Room != nil {
+			callRoomsMutex.Lock()
+			callRooms[callRoomKey(meta, msg.Timestamp)] = history.Messages[0].Room
+			callRoomsMutex.Unlock()
+		}
+	}
+}
+
+// callText returns what the renderers show for a call message of meta: who
+// started the call, how long it lasted and how many took part, as far as
+// known. The name of who started it is put in through label.
+func callText(msg slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options, label func(string) string) string {
+	kind := "Call"
+	if msg.SubType == "huddle_thread" {
+		kind = "Huddle"
+	}
+
+	callRoomsMutex.Lock()
+	room := callRooms[callRoomKey(meta, msg.Timestamp)]
+	callRoomsMutex.Unlock()
+
+	starter := msg.User
+	if room != nil && room.CreatedBy != "" {
+		starter = room.CreatedBy
+	}
+	if user, ok := usersMap.get(starter); ok {
+		starter = user.Label(opts.nameField)
+	}
+	text := kind + " started by " + label(starter)
+	if room == nil {
+		return text
+	}
+
+	if room.DateStart > 0 && room.DateEnd >= room.DateStart {
+		text += ", duration " + (time.Duration(room.DateEnd-room.DateStart) * time.Second).String()
+	}
+	participants := len(room.ParticipantHistory)
+	if participants == 0 {
+		participants = len(room.Participants)
+	}
+	if participants > 0 {
+		text += fmt.Sprintf(", %d participants", participants)
+	}
+	return text
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nlopes/slack"
+	"github.com/urfave/cli/v2"
+)
+
+// list prints the public and private channels the token can see.
+func list(c *cli.Context) error {
+	api, _ := newClient(c, tokenFrom(c))
+
+	channels, err := api.GetChannels(false)
+	check(err)
+	groups, err := api.GetGroups(false)
+	check(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tTYPE\tMEMBERS\tARCHIVED")
+	for _, channel := range channels {
+		fmt.Fprintf(w, "%s\t%s\tpublic\t%d\t%t\n", channel.Name, channel.ID, len(channel.Members), channel.IsArchived)
+	}
+	for _, group := range groups {
+		kind := "private"
+		if group.IsMpIM {
+			kind = "mpim"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%t\n", group.Name, group.ID, kind, len(group.Members), group.IsArchived)
+	}
+	w.Flush()
+	return nil
+}
+
+// listUsers prints the users of the workspace.
+func listUsers(c *cli.Context) error {
+	api, _ := newClient(c, tokenFrom(c))
+
+	users, err := fetchUsers(api)
+	check(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tREAL NAME\tDISPLAY NAME\tDELETED\tBOT")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%t\n", user.Name, user.ID, user.RealName, user.Profile.DisplayName, user.Deleted, user.IsBot)
+	}
+	w.Flush()
+	return nil
+}
+
+// checkToken prints the workspace, the user and the scopes of the token,
+// and exits as newClient does when Slack refuses it.
+func checkToken(c *cli.Context) error {
+	token := tokenFrom(c)
+	_, auth := newClient(c, token)
+
+	scopes, err := tokenScopes(apiURLFrom(c), token)
+	check(err)
+	if scopes == "" {
+		scopes = "(not reported for this kind of token)"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "workspace:\t%s (%s, %s)\n", auth.Team, auth.TeamID, auth.URL)
+	fmt.Fprintf(w, "user:\t%s (%s)\n", auth.User, auth.UserID)
+	if isBotToken(&options{token: token, apiURL: apiURLFrom(c)}) {
+		fmt.Fprintf(w, "token:\tbot, which only reads the channels the bot is in\n")
+	} else {
+		fmt.Fprintf(w, "token:\tuser, which reads what the user can\n")
+	}
+	fmt.Fprintf(w, "scopes:\t%s\n", strings.Replace(scopes, ",", ", ", -1))
+	w.Flush()
+	return nil
+}
+
+// tokenScopes returns the scopes granted to token, which Slack only tells
+// in the X-OAuth-Scopes header of its answers.
+func tokenScopes(apiURL string, token string) (string, error) {
+	req, err := http.NewRequest("POST", apiURL+"auth.test", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Transport: withTokenRefresh(retryingTransport{countingTransport{baseTransport}})}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("X-OAuth-Scopes"), nil
+}
+
+// verify checks an export archive, or a directory holding an unpacked one,
+// against the Slack export format, and exits with status 1 if it does not
+// match.
+func verify(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		name = "slackdump.zip"
+	}
+	info, err := os.Stat(name)
+	check(err)
+
+	dir := name
+	if !info.IsDir() {
+		dir, err = ioutil.TempDir("", "slack-dump-verify")
+		check(err)
+		defer os.RemoveAll(dir)
+		unzip(name, dir)
+	}
+
+	// Our archives keep everything under one top-level folder.
+	entries, err := ioutil.ReadDir(dir)
+	check(err)
+	if len(entries) == 1 && entries[0].IsDir() {
+		dir = filepath.Join(dir, entries[0].Name())
+	}
+
+	validateExport(dir)
+	if len(exportWarnings) > 0 {
+		os.Exit(exitFailure)
+	}
+	logf("%s matches the Slack export format", name)
+	return nil
+}
+
+// unzip extracts the zip file at name into dir.
+func unzip(name, dir string) {
+	r, err := zip.OpenReader(name)
+	check(err)
+	defer r.Close()
+
+	for _, f := range r.File {
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			panic(fmt.Errorf("%s: illegal file path %s", name, f.Name))
+		}
+		if f.FileInfo().IsDir() {
+			check(os.MkdirAll(target, 0755))
+			continue
+		}
+		check(os.MkdirAll(filepath.Dir(target), 0755))
+
+		in, err := f.Open()
+		check(err)
+		out, err := os.Create(target)
+		check(err)
+		_, err = io.Copy(out, in)
+		check(err)
+		check(out.Close())
+		in.Close()
+	}
+}
+
+// thread prints the thread started by the message at ts in a channel, given
+// by name or ID, as plain text.
+func thread(c *cli.Context) error {
+	if c.NArg() != 2 {
+		fmt.Println("ERROR: the thread command needs a channel and a thread ts...")
+		fmt.Println("")
+		cli.ShowCommandHelp(c, "thread")
+		os.Exit(exitUsage)
+	}
+	opts := &options{
+		nameField:    c.String("name-field"),
+		dateFormat:   layoutFrom(c, "date-format"),
+		locale:       localeFrom(c),
+		timeFormat:   layoutFrom(c, "time-format"),
+		emojiUnicode: c.Bool("emoji-unicode"),
+	}
+	api, _ := newClient(c, tokenFrom(c))
+	opts.userGroups = fetchUserGroups(api)
+
+	meta := findChannel(api, c.Args().Get(0))
+	if meta == nil {
+		logf("ERROR: the channel %s does not exist...", c.Args().Get(0))
+		os.Exit(exitUsage)
+	}
+
+	var messages []slack.Message
+	params := &slack.GetConversationRepliesParameters{ChannelID: meta.ID, Timestamp: c.Args().Get(1)}
+	for {
+		replies, hasMore, cursor, err := api.GetConversationReplies(params)
+		check(err)
+		messages = append(messages, replies...)
+		if !hasMore || cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+
+	users, err := fetchUsers(api)
+	check(err)
+	os.Stdout.Write(renderText(messages, meta, buildUsersMap(users, opts), opts))
+	return nil
+}
+
+// findChannel looks up a public or private channel by name or ID.
+func findChannel(api *slack.Client, nameOrID string) *ChannelMeta {
+	channels, err := api.GetChannels(false)
+	check(err)
+	for _, channel := range channels {
+		if channel.Name == nameOrID || channel.ID == nameOrID {
+			return channelMeta(channel)
+		}
+	}
+
+	groups, err := api.GetGroups(false)
+	check(err)
+	for _, group := range groups {
+		if group.Name == nameOrID || group.ID == nameOrID {
+			return groupMeta(group)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// runContext is done once the --timeout of the run has passed. Every request
+// to Slack is made with it, so that one under way when it does, a download
+// included, is cut short; the rest of the work stops at the next page or
+// conversation, so that what was dumped can still be archived.
+var runContext = context.Background()
+var cancelRun context.CancelFunc = func() {}
+
+// errTimeout is the error of a request, or of a wait before one, that the
+// run's --timeout cut short.
+var errTimeout = errors.New("the run's timeout was reached")
+
+// startDeadline makes runContext done after timeout.
+func startDeadline(timeout time.Duration) {
+	runContext, cancelRun = context.WithTimeout(context.Background(), timeout)
+}
+
+// timeoutError returns errTimeout in place of err once the run's --timeout
+// has passed, as the error a cut request fails with does not say why.
+func timeoutError(err error) error {
+	if err != nil && timedOut() {
+		return errTimeout
+	}
+	return err
+}
+
+// isTimeout reports whether err comes from the run's --timeout: errTimeout,
+// or the error of a response body cut short by it.
+func isTimeout(err error) bool {
+	return errors.Is(err, errTimeout) || (errors.Is(err, context.DeadlineExceeded) && timedOut())
+}
+
+// sleepUntilTimeout waits for d, or until the run's --timeout has passed,
+// which it returns errTimeout for.
+func sleepUntilTimeout(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-runContext.Done():
+		timedOut()
+		return errTimeout
+	}
+}
+
+// stoppedByTimeout is set once the timeout has left something out of the
+// dump, as a timeout reached while archiving leaves the dump whole.
+var stoppedByTimeout bool
+var timeoutOnce sync.Once
+
+// timedOut reports whether the run's --timeout has passed, for work that
+// would be left out because of it, and says so the first time.
+func timedOut() bool {
+	if runContext.Err() == nil {
+		return false
+	}
+	timeoutOnce.Do(func() {
+		stoppedByTimeout = true
+		addWarning("the run's timeout was reached, the conversations and files not dumped yet were left out")
+	})
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// insideDir reports whether the directory raw is dir or inside it.
+func insideDir(raw string, dir string) bool {
+	raw, err := filepath.Abs(raw)
+	if err != nil {
+		return false
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, raw)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// rawResponses counts the API answers saved by --debug-raw, which numbers
+// their files in the order they came in.
+var rawResponses int64
+
+// saveRawResponses makes baseTransport also save the body of every answer
+// of the API at apiURL, as Slack sent it, into dir. It is for comparing what
+// Slack said with what ended up in the export.
+func saveRawResponses(dir string, apiURL string) {
+	err := os.MkdirAll(dir, 0755)
+	check(err)
+	baseTransport = rawTransport{base: baseTransport, dir: dir, apiURL: apiURL}
+}
+
+// rawTransport saves each JSON answer of the API to <n>-<method>.json in dir
+// before handing it on. File downloads, JSON files among them, are left
+// alone, and so are the oauth methods, whose answers hold tokens.
+type rawTransport struct {
+	base   http.RoundTripper
+	dir    string
+	apiURL string
+}
+
+func (t rawTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	method := path.Base(req.URL.Path)
+	if err != nil || !strings.HasPrefix(req.URL.String(), t.apiURL) || strings.HasPrefix(method, "oauth.") ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return resp, err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	n := atomic.AddInt64(&rawResponses, 1)
+	name := path.Join(t.dir, fmt.Sprintf("%06d-%s.json", n, method))
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		addWarning("could not save the raw answer of %s: %v", method, err)
+	}
+	return resp, nil
+}
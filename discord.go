@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/nlopes/slack"
+)
+
+// The discord format follows the JSON layout of DiscordChatExporter, which
+// the tools that import history into Discord read. Slack users, channels
+// and messages are fitted into it as closely as they go; the workspace
+// stands in for the guild.
+
+type discordExport struct {
+	Guild        discordGuild     `json:"guild"`
+	Channel      discordChannel   `json:"channel"`
+	Messages     []discordMessage `json:"messages"`
+	MessageCount int              `json:"messageCount"`
+}
+
+type discordGuild struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type discordChannel struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Topic    string `json:"topic"`
+}
+
+type discordMessage struct {
+	ID              string              `json:"id"`
+	Type            string              `json:"type"`
+	Timestamp       string              `json:"timestamp"`
+	TimestampEdited *string             `json:"timestampEdited"`
+	IsPinned        bool                `json:"isPinned"`
+	Content         string              `json:"content"`
+	Author          discordAuthor       `json:"author"`
+	Attachments     []discordAttachment `json:"attachments"`
+	Reactions       []discordReaction   `json:"reactions"`
+}
+
+type discordAuthor struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Nickname string `json:"nickname"`
+	IsBot    bool   `json:"isBot"`
+}
+
+type discordAttachment struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	FileName      string `json:"fileName"`
+	FileSizeBytes int    `json:"fileSizeBytes"`
+}
+
+type discordReaction struct {
+	Emoji discordEmoji `json:"emoji"`
+	Count int          `json:"count"`
+}
+
+type discordEmoji struct {
+	Name string `json:"name"`
+}
+
+// discordTime is how DiscordChatExporter writes times.
+const discordTime = "2006-01-02T15:04:05.000-07:00"
+
+func renderDiscord(messages []slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) []byte {
+	export := discordExport{
+		Guild: discordGuild{ID: opts.teamID, Name: opts.teamName},
+		Channel: discordChannel{
+			ID:       meta.ID,
+			Type:     "GuildTextChat",
+			Category: map[string]string{"channel": "Channels", "group": "Private channels", "dm": "Direct messages"}[meta.Type],
+			Name:     meta.Name,
+			Topic:    meta.Topic,
+		},
+		Messages:     []discordMessage{},
+		MessageCount: len(messages),
+	}
+	if meta.Type == "dm" {
+		export.Channel.Type = "DirectTextChat"
+	}
+
+	for _, msg := range messages {
+		timestamp, ts := parsePreciseTimestamp(msg.Timestamp)
+		m := discordMessage{
+			ID:          ts,
+			Type:        "Default",
+			Timestamp:   formatTime(timestamp, discordTime),
+			IsPinned:    len(msg.PinnedTo) > 0,
+			Content:     convertMrkdwn(messageText(msg, meta, usersMap, opts), markdownTarget),
+			Attachments: []discordAttachment{},
+			Reactions:   []discordReaction{},
+		}
+		if membershipActions[msg.SubType] == "joined" {
+			m.Type = "GuildMemberJoin"
+		}
+		if msg.Edited != nil && msg.Edited.Timestamp != "" {
+			edited, _ := parsePreciseTimestamp(msg.Edited.Timestamp)
+			when := formatTime(edited, discordTime)
+			m.TimestampEdited = &when
+		}
+
+		m.Author = discordAuthor{ID: msg.User, Name: msg.Username, IsBot: msg.BotID != ""}
+		if user, ok := usersMap.get(msg.User); ok {
+			m.Author.Name = user.Login
+			m.Author.Nickname = user.Label(opts.nameField)
+		}
+		if m.Author.ID == "" {
+			m.Author.ID = msg.BotID
+		}
+
+		for _, f := range messageFiles(msg) {
+			m.Attachments = append(m.Attachments, discordAttachment{
+				ID:            f.ID,
+				URL:           f.URLPrivate,
+				FileName:      f.Name,
+				FileSizeBytes: f.Size,
+			})
+		}
+		for _, reaction := range msg.Reactions {
+			m.Reactions = append(m.Reactions, discordReaction{discordEmoji{reaction.Name}, reaction.Count})
+		}
+		export.Messages = append(export.Messages, m)
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	check(err)
+	return data
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// emojiRE matches an emoji shortcode such as :smile: or :+1:, followed by a
+// skin tone such as :skin-tone-3: or not.
+var emojiRE = regexp.MustCompile(`:([a-z0-9_+-]+):(:skin-tone-([2-6]):)?`)
+
+// skinTones are the modifiers of the :skin-tone-2: to :skin-tone-6:
+// shortcodes.
+var skinTones = map[string]string{
+	"2": "\U0001F3FB", "3": "\U0001F3FC", "4": "\U0001F3FD", "5": "\U0001F3FE", "6": "\U0001F3FF",
+}
+
+// emojiUnicode replaces the shortcodes of standard emoji in text with the
+// emoji themselves. The shortcodes of a workspace's custom emoji, and of
+// standard ones missing from standardEmoji, are left as they are.
+func emojiUnicode(text string) string {
+	if !strings.Contains(text, ":") {
+		return text
+	}
+	return emojiRE.ReplaceAllStringFunc(text, func(code string) string {
+		m := emojiRE.FindStringSubmatch(code)
+		glyph, ok := standardEmoji[m[1]]
+		if !ok {
+			return code
+		}
+		if m[3] != "" {
+			// The skin tone goes right after the person or hand, in place
+			// of the selector asking to show it as an emoji, if any.
+			r, size := utf8.DecodeRuneInString(glyph)
+			glyph = string(r) + skinTones[m[3]] + strings.TrimPrefix(glyph[size:], "\uFE0F")
+		}
+		return glyph
+	})
+}
+
+// standardEmoji maps the Slack shortcodes of the most used standard emoji
+// to the emoji.
+var standardEmoji = map[string]string{
+	"smile":                                 "😄",
+	"smiley":                                "😃",
+	"grinning":                              "😀",
+	"grin":                                  "😁",
+	"laughing":                              "😆",
+	"satisfied":                             "😆",
+	"sweat_smile":                           "😅",
+	"joy":                                   "😂",
+	"rolling_on_the_floor_laughing":         "🤣",
+	"rofl":                                  "🤣",
+	"slightly_smiling_face":                 "🙂",
+	"upside_down_face":                      "🙃",
+	"wink":                                  "😉",
+	"blush":                                 "😊",
+	"innocent":                              "😇",
+	"heart_eyes":                            "😍",
+	"star-struck":                           "🤩",
+	"kissing_heart":                         "😘",
+	"kissing":                               "😗",
+	"relaxed":                               "☺️",
+	"yum":                                   "😋",
+	"stuck_out_tongue":                      "😛",
+	"stuck_out_tongue_winking_eye":          "😜",
+	"zany_face":                             "🤪",
+	"stuck_out_tongue_closed_eyes":          "😝",
+	"money_mouth_face":                      "🤑",
+	"hugging_face":                          "🤗",
+	"hugs":                                  "🤗",
+	"thinking_face":                         "🤔",
+	"thinking":                              "🤔",
+	"zipper_mouth_face":                     "🤐",
+	"raised_eyebrow":                        "🤨",
+	"neutral_face":                          "😐",
+	"expressionless":                        "😑",
+	"no_mouth":                              "😶",
+	"smirk":                                 "😏",
+	"unamused":                              "😒",
+	"face_with_rolling_eyes":                "🙄",
+	"roll_eyes":                             "🙄",
+	"grimacing":                             "😬",
+	"lying_face":                            "🤥",
+	"relieved":                              "😌",
+	"pensive":                               "😔",
+	"sleepy":                                "😪",
+	"drooling_face":                         "🤤",
+	"sleeping":                              "😴",
+	"mask":                                  "😷",
+	"face_with_thermometer":                 "🤒",
+	"face_with_head_bandage":                "🤕",
+	"nauseated_face":                        "🤢",
+	"sneezing_face":                         "🤧",
+	"hot_face":                              "🥵",
+	"cold_face":                             "🥶",
+	"woozy_face":                            "🥴",
+	"dizzy_face":                            "😵",
+	"exploding_head":                        "🤯",
+	"face_with_cowboy_hat":                  "🤠",
+	"cowboy_hat_face":                       "🤠",
+	"partying_face":                         "🥳",
+	"sunglasses":                            "😎",
+	"nerd_face":                             "🤓",
+	"confused":                              "😕",
+	"worried":                               "😟",
+	"slightly_frowning_face":                "🙁",
+	"white_frowning_face":                   "☹️",
+	"open_mouth":                            "😮",
+	"hushed":                                "😯",
+	"astonished":                            "😲",
+	"flushed":                               "😳",
+	"pleading_face":                         "🥺",
+	"frowning":                              "😦",
+	"anguished":                             "😧",
+	"fearful":                               "😨",
+	"cold_sweat":                            "😰",
+	"disappointed_relieved":                 "😥",
+	"cry":                                   "😢",
+	"sob":                                   "😭",
+	"scream":                                "😱",
+	"confounded":                            "😖",
+	"persevere":                             "😣",
+	"disappointed":                          "😞",
+	"sweat":                                 "😓",
+	"weary":                                 "😩",
+	"tired_face":                            "😫",
+	"yawning_face":                          "🥱",
+	"triumph":                               "😤",
+	"rage":                                  "😡",
+	"angry":                                 "😠",
+	"face_with_symbols_on_mouth":            "🤬",
+	"smiling_imp":                           "😈",
+	"imp":                                   "👿",
+	"skull":                                 "💀",
+	"hankey":                                "💩",
+	"poop":                                  "💩",
+	"clown_face":                            "🤡",
+	"ghost":                                 "👻",
+	"alien":                                 "👽",
+	"robot_face":                            "🤖",
+	"robot":                                 "🤖",
+	"smiley_cat":                            "😺",
+	"see_no_evil":                           "🙈",
+	"hear_no_evil":                          "🙉",
+	"speak_no_evil":                         "🙊",
+	"wave":                                  "👋",
+	"raised_back_of_hand":                   "🤚",
+	"raised_hand":                           "✋",
+	"hand":                                  "✋",
+	"spock-hand":                            "🖖",
+	"ok_hand":                               "👌",
+	"pinching_hand":                         "🤏",
+	"v":                                     "✌️",
+	"crossed_fingers":                       "🤞",
+	"the_horns":                             "🤘",
+	"call_me_hand":                          "🤙",
+	"point_left":                            "👈",
+	"point_right":                           "👉",
+	"point_up_2":                            "👆",
+	"point_down":                            "👇",
+	"point_up":                              "☝️",
+	"+1":                                    "👍",
+	"thumbsup":                              "👍",
+	"-1":                                    "👎",
+	"thumbsdown":                            "👎",
+	"fist":                                  "✊",
+	"facepunch":                             "👊",
+	"punch":                                 "👊",
+	"clap":                                  "👏",
+	"raised_hands":                          "🙌",
+	"open_hands":                            "👐",
+	"palms_up_together":                     "🤲",
+	"handshake":                             "🤝",
+	"pray":                                  "🙏",
+	"writing_hand":                          "✍️",
+	"nail_care":                             "💅",
+	"muscle":                                "💪",
+	"eyes":                                  "👀",
+	"eye":                                   "👁️",
+	"brain":                                 "🧠",
+	"tongue":                                "👅",
+	"lips":                                  "👄",
+	"baby":                                  "👶",
+	"boy":                                   "👦",
+	"girl":                                  "👧",
+	"man":                                   "👨",
+	"woman":                                 "👩",
+	"older_man":                             "👴",
+	"older_woman":                           "👵",
+	"shrug":                                 "🤷",
+	"facepalm":                              "🤦",
+	"face_palm":                             "🤦",
+	"bow":                                   "🙇",
+	"raising_hand":                          "🙋",
+	"no_good":                               "🙅",
+	"ok_woman":                              "🙆",
+	"information_desk_person":               "💁",
+	"man-shrugging":                         "🤷‍♂️",
+	"woman-shrugging":                       "🤷‍♀️",
+	"man-facepalming":                       "🤦‍♂️",
+	"woman-facepalming":                     "🤦‍♀️",
+	"runner":                                "🏃",
+	"running":                               "🏃",
+	"dancer":                                "💃",
+	"man_dancing":                           "🕺",
+	"heart":                                 "❤️",
+	"orange_heart":                          "🧡",
+	"yellow_heart":                          "💛",
+	"green_heart":                           "💚",
+	"blue_heart":                            "💙",
+	"purple_heart":                          "💜",
+	"black_heart":                           "🖤",
+	"white_heart":                           "🤍",
+	"broken_heart":                          "💔",
+	"two_hearts":                            "💕",
+	"sparkling_heart":                       "💖",
+	"heartpulse":                            "💗",
+	"heartbeat":                             "💓",
+	"revolving_hearts":                      "💞",
+	"cupid":                                 "💘",
+	"gift_heart":                            "💝",
+	"heart_decoration":                      "💟",
+	"heavy_heart_exclamation_mark_ornament": "❣️",
+	"kiss":                                  "💋",
+	"100":                                   "💯",
+	"anger":                                 "💢",
+	"boom":                                  "💥",
+	"collision":                             "💥",
+	"dizzy":                                 "💫",
+	"sweat_drops":                           "💦",
+	"dash":                                  "💨",
+	"speech_balloon":                        "💬",
+	"thought_balloon":                       "💭",
+	"zzz":                                   "💤",
+	"fire":                                  "🔥",
+	"sparkles":                              "✨",
+	"star":                                  "⭐",
+	"star2":                                 "🌟",
+	"zap":                                   "⚡",
+	"sunny":                                 "☀️",
+	"cloud":                                 "☁️",
+	"umbrella":                              "☔",
+	"snowflake":                             "❄️",
+	"rainbow":                               "🌈",
+	"ocean":                                 "🌊",
+	"earth_africa":                          "🌍",
+	"earth_americas":                        "🌎",
+	"earth_asia":                            "🌏",
+	"globe_with_meridians":                  "🌐",
+	"full_moon":                             "🌕",
+	"new_moon":                              "🌑",
+	"crescent_moon":                         "🌙",
+	"dog":                                   "🐶",
+	"cat":                                   "🐱",
+	"mouse":                                 "🐭",
+	"rabbit":                                "🐰",
+	"fox_face":                              "🦊",
+	"bear":                                  "🐻",
+	"panda_face":                            "🐼",
+	"koala":                                 "🐨",
+	"tiger":                                 "🐯",
+	"lion_face":                             "🦁",
+	"cow":                                   "🐮",
+	"pig":                                   "🐷",
+	"frog":                                  "🐸",
+	"monkey_face":                           "🐵",
+	"chicken":                               "🐔",
+	"penguin":                               "🐧",
+	"bird":                                  "🐦",
+	"eagle":                                 "🦅",
+	"owl":                                   "🦉",
+	"bee":                                   "🐝",
+	"honeybee":                              "🐝",
+	"bug":                                   "🐛",
+	"butterfly":                             "🦋",
+	"snail":                                 "🐌",
+	"turtle":                                "🐢",
+	"snake":                                 "🐍",
+	"octopus":                               "🐙",
+	"fish":                                  "🐟",
+	"whale":                                 "🐳",
+	"dolphin":                               "🐬",
+	"shark":                                 "🦈",
+	"unicorn_face":                          "🦄",
+	"horse":                                 "🐴",
+	"camel":                                 "🐫",
+	"elephant":                              "🐘",
+	"sloth":                                 "🦥",
+	"llama":                                 "🦙",
+	"t-rex":                                 "🦖",
+	"sauropod":                              "🦕",
+	"seedling":                              "🌱",
+	"evergreen_tree":                        "🌲",
+	"deciduous_tree":                        "🌳",
+	"palm_tree":                             "🌴",
+	"cactus":                                "🌵",
+	"herb":                                  "🌿",
+	"four_leaf_clover":                      "🍀",
+	"maple_leaf":                            "🍁",
+	"fallen_leaf":                           "🍂",
+	"mushroom":                              "🍄",
+	"tulip":                                 "🌷",
+	"rose":                                  "🌹",
+	"sunflower":                             "🌻",
+	"blossom":                               "🌼",
+	"cherry_blossom":                        "🌸",
+	"bouquet":                               "💐",
+	"apple":                                 "🍎",
+	"green_apple":                           "🍏",
+	"pear":                                  "🍐",
+	"tangerine":                             "🍊",
+	"lemon":                                 "🍋",
+	"banana":                                "🍌",
+	"watermelon":                            "🍉",
+	"grapes":                                "🍇",
+	"strawberry":                            "🍓",
+	"peach":                                 "🍑",
+	"cherries":                              "🍒",
+	"pineapple":                             "🍍",
+	"avocado":                               "🥑",
+	"eggplant":                              "🍆",
+	"tomato":                                "🍅",
+	"hot_pepper":                            "🌶️",
+	"corn":                                  "🌽",
+	"carrot":                                "🥕",
+	"potato":                                "🥔",
+	"bread":                                 "🍞",
+	"cheese_wedge":                          "🧀",
+	"egg":                                   "🥚",
+	"bacon":                                 "🥓",
+	"hamburger":                             "🍔",
+	"fries":                                 "🍟",
+	"pizza":                                 "🍕",
+	"hotdog":                                "🌭",
+	"taco":                                  "🌮",
+	"burrito":                               "🌯",
+	"popcorn":                               "🍿",
+	"ramen":                                 "🍜",
+	"spaghetti":                             "🍝",
+	"sushi":                                 "🍣",
+	"bento":                                 "🍱",
+	"rice":                                  "🍚",
+	"curry":                                 "🍛",
+	"doughnut":                              "🍩",
+	"cookie":                                "🍪",
+	"birthday":                              "🎂",
+	"cake":                                  "🍰",
+	"chocolate_bar":                         "🍫",
+	"candy":                                 "🍬",
+	"lollipop":                              "🍭",
+	"ice_cream":                             "🍨",
+	"icecream":                              "🍦",
+	"coffee":                                "☕",
+	"tea":                                   "🍵",
+	"beer":                                  "🍺",
+	"beers":                                 "🍻",
+	"wine_glass":                            "🍷",
+	"cocktail":                              "🍸",
+	"tropical_drink":                        "🍹",
+	"champagne":                             "🍾",
+	"clinking_glasses":                      "🥂",
+	"tumbler_glass":                         "🥃",
+	"knife_fork_plate":                      "🍽️",
+	"soccer":                                "⚽",
+	"basketball":                            "🏀",
+	"football":                              "🏈",
+	"baseball":                              "⚾",
+	"tennis":                                "🎾",
+	"volleyball":                            "🏐",
+	"rugby_football":                        "🏉",
+	"8ball":                                 "🎱",
+	"golf":                                  "⛳",
+	"trophy":                                "🏆",
+	"medal":                                 "🏅",
+	"first_place_medal":                     "🥇",
+	"second_place_medal":                    "🥈",
+	"third_place_medal":                     "🥉",
+	"dart":                                  "🎯",
+	"video_game":                            "🎮",
+	"game_die":                              "🎲",
+	"jigsaw":                                "🧩",
+	"art":                                   "🎨",
+	"musical_note":                          "🎵",
+	"notes":                                 "🎶",
+	"microphone":                            "🎤",
+	"headphones":                            "🎧",
+	"guitar":                                "🎸",
+	"tada":                                  "🎉",
+	"confetti_ball":                         "🎊",
+	"balloon":                               "🎈",
+	"gift":                                  "🎁",
+	"ribbon":                                "🎀",
+	"christmas_tree":                        "🎄",
+	"jack_o_lantern":                        "🎃",
+	"fireworks":                             "🎆",
+	"sparkler":                              "🎇",
+	"calendar":                              "📆",
+	"date":                                  "📅",
+	"spiral_calendar_pad":                   "🗓️",
+	"clock1":                                "🕐",
+	"hourglass":                             "⌛",
+	"hourglass_flowing_sand":                "⏳",
+	"watch":                                 "⌚",
+	"alarm_clock":                           "⏰",
+	"stopwatch":                             "⏱️",
+	"car":                                   "🚗",
+	"red_car":                               "🚗",
+	"taxi":                                  "🚕",
+	"bus":                                   "🚌",
+	"ambulance":                             "🚑",
+	"fire_engine":                           "🚒",
+	"police_car":                            "🚓",
+	"truck":                                 "🚚",
+	"bike":                                  "🚲",
+	"train":                                 "🚆",
+	"airplane":                              "✈️",
+	"rocket":                                "🚀",
+	"helicopter":                            "🚁",
+	"boat":                                  "⛵",
+	"ship":                                  "🚢",
+	"anchor":                                "⚓",
+	"construction":                          "🚧",
+	"rotating_light":                        "🚨",
+	"house":                                 "🏠",
+	"office":                                "🏢",
+	"hospital":                              "🏥",
+	"school":                                "🏫",
+	"tent":                                  "⛺",
+	"world_map":                             "🗺️",
+	"iphone":                                "📱",
+	"computer":                              "💻",
+	"keyboard":                              "⌨️",
+	"desktop_computer":                      "🖥️",
+	"printer":                               "🖨️",
+	"floppy_disk":                           "💾",
+	"cd":                                    "💿",
+	"camera":                                "📷",
+	"movie_camera":                          "🎥",
+	"tv":                                    "📺",
+	"phone":                                 "☎️",
+	"telephone_receiver":                    "📞",
+	"battery":                               "🔋",
+	"electric_plug":                         "🔌",
+	"bulb":                                  "💡",
+	"flashlight":                            "🔦",
+	"candle":                                "🕯️",
+	"moneybag":                              "💰",
+	"dollar":                                "💵",
+	"credit_card":                           "💳",
+	"gem":                                   "💎",
+	"wrench":                                "🔧",
+	"hammer":                                "🔨",
+	"hammer_and_wrench":                     "🛠️",
+	"nut_and_bolt":                          "🔩",
+	"gear":                                  "⚙️",
+	"link":                                  "🔗",
+	"chains":                                "⛓️",
+	"toolbox":                               "🧰",
+	"magnet":                                "🧲",
+	"microscope":                            "🔬",
+	"telescope":                             "🔭",
+	"satellite_antenna":                     "📡",
+	"syringe":                               "💉",
+	"pill":                                  "💊",
+	"door":                                  "🚪",
+	"bed":                                   "🛏️",
+	"toilet":                                "🚽",
+	"shower":                                "🚿",
+	"key":                                   "🔑",
+	"old_key":                               "🗝️",
+	"lock":                                  "🔒",
+	"unlock":                                "🔓",
+	"bell":                                  "🔔",
+	"no_bell":                               "🔕",
+	"bookmark":                              "🔖",
+	"label":                                 "🏷️",
+	"email":                                 "📧",
+	"envelope":                              "✉️",
+	"incoming_envelope":                     "📨",
+	"inbox_tray":                            "📥",
+	"outbox_tray":                           "📤",
+	"package":                               "📦",
+	"mailbox":                               "📫",
+	"pencil2":                               "✏️",
+	"pencil":                                "📝",
+	"memo":                                  "📝",
+	"pen":                                   "🖊️",
+	"briefcase":                             "💼",
+	"file_folder":                           "📁",
+	"open_file_folder":                      "📂",
+	"page_facing_up":                        "📄",
+	"page_with_curl":                        "📃",
+	"bookmark_tabs":                         "📑",
+	"bar_chart":                             "📊",
+	"chart_with_upwards_trend":              "📈",
+	"chart_with_downwards_trend":            "📉",
+	"clipboard":                             "📋",
+	"pushpin":                               "📌",
+	"round_pushpin":                         "📍",
+	"paperclip":                             "📎",
+	"straight_ruler":                        "📏",
+	"triangular_ruler":                      "📐",
+	"scissors":                              "✂️",
+	"wastebasket":                           "🗑️",
+	"books":                                 "📚",
+	"book":                                  "📖",
+	"notebook":                              "📓",
+	"ledger":                                "📒",
+	"newspaper":                             "📰",
+	"mag":                                   "🔍",
+	"mag_right":                             "🔎",
+	"warning":                               "⚠️",
+	"no_entry":                              "⛔",
+	"no_entry_sign":                         "🚫",
+	"x":                                     "❌",
+	"heavy_multiplication_x":                "✖️",
+	"o":                                     "⭕",
+	"white_check_mark":                      "✅",
+	"heavy_check_mark":                      "✔️",
+	"ballot_box_with_check":                 "☑️",
+	"heavy_plus_sign":                       "➕",
+	"heavy_minus_sign":                      "➖",
+	"heavy_division_sign":                   "➗",
+	"question":                              "❓",
+	"grey_question":                         "❔",
+	"exclamation":                           "❗",
+	"heavy_exclamation_mark":                "❗",
+	"grey_exclamation":                      "❕",
+	"bangbang":                              "‼️",
+	"interrobang":                           "⁉️",
+	"recycle":                               "♻️",
+	"arrow_up":                              "⬆️",
+	"arrow_down":                            "⬇️",
+	"arrow_left":                            "⬅️",
+	"arrow_right":                           "➡️",
+	"arrow_upper_right":                     "↗️",
+	"arrow_lower_right":                     "↘️",
+	"arrows_counterclockwise":               "🔄",
+	"repeat":                                "🔁",
+	"arrow_forward":                         "▶️",
+	"arrow_backward":                        "◀️",
+	"fast_forward":                          "⏩",
+	"rewind":                                "⏪",
+	"double_vertical_bar":                   "⏸️",
+	"black_square_for_stop":                 "⏹️",
+	"new":                                   "🆕",
+	"free":                                  "🆓",
+	"up":                                    "🆙",
+	"cool":                                  "🆒",
+	"ok":                                    "🆗",
+	"sos":                                   "🆘",
+	"information_source":                    "ℹ️",
+	"copyright":                             "©️",
+	"registered":                            "®️",
+	"tm":                                    "™️",
+	"red_circle":                            "🔴",
+	"large_blue_circle":                     "🔵",
+	"large_green_circle":                    "🟢",
+	"large_yellow_circle":                   "🟡",
+	"large_orange_circle":                   "🟠",
+	"white_circle":                          "⚪",
+	"black_circle":                          "⚫",
+	"checkered_flag":                        "🏁",
+	"triangular_flag_on_post":               "🚩",
+	"crossed_flags":                         "🎌",
+	"waving_black_flag":                     "🏴",
+	"waving_white_flag":                     "🏳️",
+	"rainbow-flag":                          "🏳️‍🌈",
+	"zero":                                  "0️⃣",
+	"one":                                   "1️⃣",
+	"two":                                   "2️⃣",
+	"three":                                 "3️⃣",
+	"four":                                  "4️⃣",
+	"five":                                  "5️⃣",
+	"six":                                   "6️⃣",
+	"seven":                                 "7️⃣",
+	"eight":                                 "8️⃣",
+	"nine":                                  "9️⃣",
+	"keycap_ten":                            "🔟",
+	"hash":                                  "#️⃣",
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// messageEvent is a pin or a reaction on a message, as saved in a
+// channel's events file. The history only tells us the current pins and
+// reactions, not when they were added.
+type messageEvent struct {
+	Type      string   `json:"type"`
+	Timestamp string   `json:"ts"`
+	User      string   `json:"user,omitempty"`
+	PinnedTo  []string `json:"pinned_to,omitempty"`
+	Reaction  string   `json:"reaction,omitempty"`
+	Count     int      `json:"count,omitempty"`
+	Users     []string `json:"users,omitempty"`
+}
+
+// writeEvents saves the pins and reactions found on messages next to the
+// channel's message files, as <filename>.events.json.
+func writeEvents(messages []slack.Message, channelDir string, filename string) {
+	var events []messageEvent
+	for _, msg := range messages {
+		if len(msg.PinnedTo) > 0 {
+			events = append(events, messageEvent{
+				Type:      "pin",
+				Timestamp: msg.Timestamp,
+				User:      msg.User,
+				PinnedTo:  msg.PinnedTo,
+			})
+		}
+		for _, reaction := range msg.Reactions {
+			events = append(events, messageEvent{
+				Type:      "reaction",
+				Timestamp: msg.Timestamp,
+				User:      msg.User,
+				Reaction:  reaction.Name,
+				Count:     reaction.Count,
+				Users:     reaction.Users,
+			})
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	data, err := MarshalIndent(events, "", "    ")
+	check(err)
+	err = writeFileIfChanged(path.Join(channelDir, filename+".events.json"), data)
+	check(err)
+}
+
+// membershipChange is a user joining or leaving a conversation, as saved in
+// a channel's membership file.
+type membershipChange struct {
+	Timestamp string `json:"ts"`
+	Time      string `json:"time"`
+	User      string `json:"user"`
+	Action    string `json:"action"`
+	Inviter   string `json:"inviter,omitempty"`
+}
+
+// membershipActions maps the subtypes of join and leave messages to what
+// they mean for the membership.
+var membershipActions = map[string]string{
+	"channel_join":  "joined",
+	"group_join":    "joined",
+	"channel_leave": "left",
+	"group_leave":   "left",
+}
+
+// writeMembership saves who joined and left the conversation and when, as
+// told by its join and leave messages, oldest first, as
+// <filename>.membership.json. It only goes as far back as the history does.
+func writeMembership(messages []slack.Message, channelDir string, filename string) {
+	var changes []membershipChange
+	for _, msg := range messages {
+		action, ok := membershipActions[msg.SubType]
+		if !ok {
+			continue
+		}
+		changes = append(changes, membershipChange{
+			Timestamp: msg.Timestamp,
+			Time:      formatTime(parseTimestamp(msg.Timestamp), time.RFC3339),
+			User:      msg.User,
+			Action:    action,
+			Inviter:   msg.Inviter,
+		})
+	}
+	if len(changes) == 0 {
+		return
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Timestamp < changes[j].Timestamp })
+
+	data, err := MarshalIndent(changes, "", "    ")
+	check(err)
+	err = writeFileIfChanged(path.Join(channelDir, filename+".membership.json"), data)
+	check(err)
+}
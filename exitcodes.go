@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"runtime"
+)
+
+// The exit codes of a run, listed in the README for scripts to tell
+// failures apart.
+const (
+	// exitOK is a run that did all it was asked to.
+	exitOK = 0
+	// exitFailure is any failure that none of the codes below describes,
+	// such as an export that verify finds does not match the format.
+	exitFailure = 1
+	// exitUsage is a flag or argument that is wrong or names something that
+	// does not exist.
+	exitUsage = 2
+	// exitAuth is a token that Slack refuses.
+	exitAuth = 3
+	// exitNetwork is Slack that cannot be reached, or that keeps failing
+	// until the retries run out.
+	exitNetwork = 4
+	// exitFilesystem is a file or folder that cannot be read or written.
+	exitFilesystem = 5
+	// exitPartial is a run that wrote its export but left out files it could
+	// not download or, with --continue-on-error, conversations.
+	exitPartial = 6
+	// exitTimeout is a run that stopped at its --timeout, and archived what
+	// it had dumped until then.
+	exitTimeout = 7
+)
+
+// authErrors are the errors Slack answers with when a token is not good
+// for the workspace any more.
+var authErrors = map[string]bool{
+	"not_authed":       true,
+	"invalid_auth":     true,
+	"account_inactive": true,
+	"token_revoked":    true,
+	"token_expired":    true,
+}
+
+// exitCode returns the exit code that describes err.
+func exitCode(err error) int {
+	var netErr net.Error
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	switch {
+	case isTimeout(err):
+		return exitTimeout
+	case errors.As(err, &netErr):
+		return exitNetwork
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return exitFilesystem
+	case authErrors[err.Error()]:
+		return exitAuth
+	}
+	return exitFailure
+}
+
+// exitOnPanic ends the run with the exit code of the error it panicked
+// with, as check does. Other panics, bugs such as a nil dereference among
+// them, go on with their stack trace. Either way the reason is logged, so
+// that the --log-file of a failed run says why it stopped.
+func exitOnPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err, ok := r.(error)
+	if _, isRuntime := r.(runtime.Error); !ok || isRuntime {
+		logf("ERROR: %v", r)
+		panic(r)
+	}
+	logf("ERROR: %v", err)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// fieldsFound are the --fields that some message had, so that the names
+// that none had, most likely misspelt, can be pointed out.
+var fieldsFound = map[string]bool{}
+var fieldsFoundMutex sync.Mutex
+
+// projectMessages returns messages with only the JSON fields named in
+// fields, such as ts and text, for --fields. A message that has no value
+// for a field leaves it out, as Slack does.
+func projectMessages(messages []slack.Message, fields []string) ([]map[string]json.RawMessage, error) {
+	projected := make([]map[string]json.RawMessage, len(messages))
+	for i, msg := range messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		projected[i] = map[string]json.RawMessage{}
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				projected[i][field] = value
+			}
+		}
+	}
+
+	fieldsFoundMutex.Lock()
+	defer fieldsFoundMutex.Unlock()
+	for _, message := range projected {
+		for field := range message {
+			fieldsFound[field] = true
+		}
+	}
+	return projected, nil
+}
+
+// warnMissingFields warns about the --fields that no message written in
+// JSON had.
+func warnMissingFields(opts *options) {
+	inJSON := false
+	for _, format := range opts.formats {
+		inJSON = inJSON || format == "json"
+	}
+	if !inJSON || stats.report().Messages == 0 {
+		return
+	}
+
+	fieldsFoundMutex.Lock()
+	defer fieldsFoundMutex.Unlock()
+	var missing []string
+	for _, field := range opts.fields {
+		if !fieldsFound[field] {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		logf("WARNING: no message had the fields %s of the fields flag, check their names", strings.Join(missing, ", "))
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nlopes/slack"
+)
+
+const downloadAttempts = 3
+
+// errStartOver is returned by fetchFrom when the partial file on disk does
+// not fit the file on the server, and has been removed so that the download
+// starts again from the beginning.
+var errStartOver = errors.New("partial download does not fit the file, starting over")
+
+// downloadSlots bounds how many files are downloaded at the same time, from
+// all the conversations being dumped together. It is sized by
+// --download-workers apart from --concurrency, since downloads are held up by
+// bandwidth rather than by Slack's rate limits.
+var downloadSlots = make(chan struct{}, 4)
+
+// messageFiles returns the files attached to msg.
+func messageFiles(msg slack.Message) []slack.File {
+	return msg.Files
+}
+
+// filePath returns where a downloaded file is kept, relative to the export.
+func filePath(f slack.File) string {
+	return path.Join("files", f.ID+"-"+sanitizeName(f.Name))
+}
+
+// thumbnailPath returns where the thumbnail at url of a file is kept,
+// relative to the export.
+func thumbnailPath(f slack.File, url string) string {
+	return filePath(f) + ".thumb" + path.Ext(url)
+}
+
+// thumbnailURL returns the address of the file's 720 pixel thumbnail, or of
+// the largest smaller one, or "" when Slack made none.
+func thumbnailURL(f slack.File) string {
+	for _, url := range []string{f.Thumb720, f.Thumb480, f.Thumb360, f.Thumb160} {
+		if url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+// downloadTarget returns what is downloaded for a file: from where, to
+// where relative to the export, and how big it should be, if known. The url
+// is "" when there is nothing to download.
+func downloadTarget(f slack.File, opts *options) (url string, target string, size int64) {
+	if opts.thumbnailsOnly {
+		url = thumbnailURL(f)
+		return url, thumbnailPath(f, url), 0
+	}
+	url = f.URLPrivateDownload
+	if url == "" {
+		url = f.URLPrivate
+	}
+	return url, filePath(f), int64(f.Size)
+}
+
+// attachedFile is a file that a dumped message refers to, where it is to be
+// downloaded to and how big it should be, if known.
+type attachedFile struct {
+	missingFile
+	size int64
+}
+
+// attachedFiles are the files that downloadFiles was given, whether or not
+// it got them, for checkFiles to look for once everything is dumped.
+var attachedFiles []attachedFile
+var attachedFilesMutex sync.Mutex
+
+// downloadFiles saves the files attached to messages, those of meta, under
+// dir/files, or with --thumbnails-only their thumbnails, and returns once
+// they are all done. Files that cannot be downloaded are reported as
+// warnings.
+func downloadFiles(messages []slack.Message, meta *ChannelMeta, dir string, opts *options) {
+	err := os.MkdirAll(path.Join(dir, "files"), 0755)
+	check(err)
+
+	var wg sync.WaitGroup
+	for _, msg := range messages {
+		for _, f := range messageFiles(msg) {
+			url, target, size := downloadTarget(f, opts)
+			if url == "" {
+				continue
+			}
+			attachedFilesMutex.Lock()
+			attachedFiles = append(attachedFiles, attachedFile{missingFile{meta.Name, msg.Timestamp, f.ID, f.Name, target}, size})
+			attachedFilesMutex.Unlock()
+			if timedOut() || !claimDownload(target) {
+				continue
+			}
+
+			downloadSlots <- struct{}{}
+			wg.Add(1)
+			go func(f slack.File) {
+				defer wg.Done()
+				defer func() { <-downloadSlots }()
+				err := downloadFile(url, path.Join(dir, target), size, opts.token)
+				if err != nil {
+					stats.addError()
+					addWarning("could not download file %s (%s): %v", f.ID, f.Name, err)
+					return
+				}
+				if err := linkSameContent(path.Join(dir, target)); err != nil {
+					logf("  could not link %s to a file with the same contents, it is kept as a copy: %v", target, err)
+				}
+			}(f)
+		}
+	}
+	wg.Wait()
+}
+
+// downloads is what the run has downloaded: the files, by where they go,
+// so that a file shared in several conversations is fetched once, and the
+// SHA-256 of their contents, by where they went.
+var downloads = struct {
+	sync.Mutex
+	started map[string]bool
+	byHash  map[[sha256.Size]byte]string
+}{started: map[string]bool{}, byHash: map[[sha256.Size]byte]string{}}
+
+// claimDownload reports whether target is still to be downloaded, and
+// counts it as under way.
+func claimDownload(target string) bool {
+	downloads.Lock()
+	defer downloads.Unlock()
+	if downloads.started[target] {
+		return false
+	}
+	downloads.started[target] = true
+	return true
+}
+
+// linkSameContent replaces the file at name with a hard link to an earlier
+// download with the same contents, such as a document uploaded again to
+// another channel, so it takes space in the dump once. Where hard links
+// cannot be made the copy is kept.
+func linkSameContent(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+
+	downloads.Lock()
+	earlier, ok := downloads.byHash[sum]
+	if !ok {
+		downloads.byHash[sum] = name
+	}
+	downloads.Unlock()
+	if !ok || earlier == name {
+		return nil
+	}
+
+	temp := name + ".link"
+	if err := os.Link(earlier, temp); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, name); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
+
+// breakLink makes target a file of its own with the same contents, so that
+// writing to it leaves alone the files linkSameContent hard-linked to it.
+func breakLink(target string) error {
+	in, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	temp := target + ".part"
+	out, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, target)
+	}
+	if err != nil {
+		os.Remove(temp)
+	}
+	return err
+}
+
+// downloadFile saves url to target. A partial download left by an earlier
+// attempt or run is carried on from where it stopped with a Range request,
+// and the result is checked against the size Slack gave for the file.
+func downloadFile(url, target string, size int64, token string) error {
+	var err error
+	for attempt := 0; attempt < downloadAttempts; attempt++ {
+		var offset int64
+		if info, statErr := os.Stat(target); statErr == nil {
+			offset = info.Size()
+		}
+		if size > 0 && offset == size {
+			return nil
+		}
+		if size > 0 && offset > size {
+			offset = 0
+		}
+
+		if attempt > 0 {
+			takeRetry()
+		}
+		err = fetchFrom(url, target, offset, token)
+		if err == errTimeout {
+			return err
+		}
+		if err == errStartOver {
+			logf("  %s: %v", path.Base(target), err)
+			continue
+		}
+		if err != nil {
+			logWith(logFields{"retry": attempt + 1}, "  download of %s failed (attempt %d/%d): %v",
+				path.Base(target), attempt+1, downloadAttempts, err)
+			continue
+		}
+		info, statErr := os.Stat(target)
+		if statErr != nil {
+			return statErr
+		}
+		if size <= 0 || info.Size() == size {
+			return nil
+		}
+		err = fmt.Errorf("got %d bytes instead of %d", info.Size(), size)
+	}
+	return err
+}
+
+// fetchFrom writes the contents of url from offset on to target.
+func fetchFrom(url, target string, offset int64, token string) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(runContext)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := &http.Client{Transport: withTokenRefresh(baseTransport)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return timeoutError(err)
+	}
+	defer resp.Body.Close()
+
+	// A file already there may be hard-linked to others with the same
+	// contents, which must not change with it.
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if err := breakLink(target); err != nil {
+			return err
+		}
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// The server sent the whole file again.
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// What we have does not fit the file, so start over.
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+		return errStartOver
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(target, flags, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, resp.Body)
+	atomic.AddInt64(&stats.Bytes, n)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return timeoutError(err)
+}
+
+// missingFile is a file that a message refers to but that is not in the
+// export, as saved in missing-files.json.
+type missingFile struct {
+	Channel   string `json:"channel"`
+	Timestamp string `json:"ts"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+}
+
+// checkFiles goes through the files attached to the messages dumped and
+// lists those that are missing from files/ in dir, or that are smaller or
+// bigger than Slack said, in missing-files.json. Failed downloads are
+// reported as they happen too; this tells for sure what the export lacks.
+// It works from the messages as they were fetched, so it does not depend on
+// which formats and fields the message files were written with.
+func checkFiles(dir string) {
+	logf("check downloaded files")
+	var missing []missingFile
+	for _, f := range attachedFiles {
+		if info, err := os.Stat(path.Join(dir, f.Path)); err == nil && (f.size <= 0 || info.Size() == f.size) {
+			continue
+		}
+		missing = append(missing, f.missingFile)
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	addWarning("%d attached files are missing from the export, see missing-files.json", len(missing))
+	data, err := MarshalIndent(missing, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "missing-files.json"), data, 0644)
+	check(err)
+}
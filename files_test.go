@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+// TestDownloadFileStartsOver has the server turn down the Range request for
+// a partial file that is bigger than the file, then send the whole file.
+func TestDownloadFileStartsOver(t *testing.T) {
+	const contents = "hello"
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Write([]byte(contents))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "slack-dump-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(target, []byte("a partial file too long"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadFile(server.URL, target, 0, "token"); err != nil {
+		t.Fatalf("downloadFile: %v", err)
+	}
+	data, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != contents {
+		t.Errorf("file holds %q, want %q", data, contents)
+	}
+	if len(ranges) != 2 || ranges[0] == "" || ranges[1] != "" {
+		t.Errorf("Range headers sent: %q, want one range then none", ranges)
+	}
+}
+
+// TestCheckFilesWithFields dumps with --fields=ts,text, which leaves the
+// files out of the JSON, and has one of the two attached files fail to
+// download: missing-files.json must still list it.
+func TestCheckFilesWithFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "slack-dump-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { attachedFiles = nil }()
+
+	messages := []slack.Message{{Msg: slack.Msg{Timestamp: "1514764800.000100", Text: "two files", Type: "message",
+		Files: []slack.File{
+			{ID: "F1", Name: "found.txt", Size: 5, URLPrivateDownload: server.URL + "/found"},
+			{ID: "F2", Name: "missing.txt", Size: 5, URLPrivateDownload: server.URL + "/missing"},
+		}}}}
+	meta := &ChannelMeta{ID: "C1", Name: "general", Type: "channel"}
+	opts := &options{formats: []string{"json"}, fields: []string{"ts", "text"}, layout: layouts["slack"], downloadFiles: true}
+	writeMessagesFile(messages, dir, "channel", meta, UsersMap{}, opts)
+	checkFiles(dir)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "missing-files.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"id": "F2"`) || strings.Contains(string(data), `"id": "F1"`) {
+		t.Errorf("missing-files.json holds\n%s\nwant F2 only", data)
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/krizz-xperi/slack-dump
+
+go 1.20
+
+require (
+	github.com/nlopes/slack v0.6.0
+	github.com/urfave/cli/v2 v2.27.7
+	golang.org/x/text v0.14.0
+)
+
+require (
+	github.com/cpuguy83/go-md2man/v2 v2.0.7 // indirect
+	github.com/gorilla/websocket v1.2.0 // indirect
+	github.com/pkg/errors v0.8.0 // indirect
+	github.com/russross/blackfriday/v2 v2.1.0 // indirect
+	github.com/xrash/smetrics v0.0.0-20240521201337-686a1a2994c1 // indirect
+)
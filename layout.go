@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path"
+
+	"github.com/nlopes/slack"
+)
+
+// layout says where the files of a conversation go in the export. kind is
+// channel, private_channel or direct_message, name is the conversation's
+// name made safe for paths, and format is the format of the file, or json
+// for the events, membership and bookmarks files.
+type layout struct {
+	// dir returns the folder of the files, relative to the export.
+	dir func(kind, name, format string) string
+	// file returns the base name of the files. day is set to the date of
+	// the messages in a message file of a layout that splits them by day.
+	file func(kind, name, day string) string
+	// byDay splits each conversation into one message file per day.
+	byDay bool
+}
+
+// layouts are the presets --layout picks from.
+var layouts = map[string]*layout{
+	// slack keeps each kind of conversation in a folder: channel/general.json.
+	"slack": {
+		dir:  func(kind, name, format string) string { return kind },
+		file: func(kind, name, day string) string { return name },
+	},
+	// flat puts every file in one folder: messages/channel-general.json.
+	"flat": {
+		dir:  func(kind, name, format string) string { return "messages" },
+		file: func(kind, name, day string) string { return kind + "-" + name },
+	},
+	// by-type keeps each format apart: html/channel/general.html.
+	"by-type": {
+		dir:  func(kind, name, format string) string { return path.Join(format, kind) },
+		file: func(kind, name, day string) string { return name },
+	},
+	// by-date gives each conversation a folder with a file per day, as in
+	// Slack's own exports: channel/general/2018-01-31.json.
+	"by-date": {
+		dir: func(kind, name, format string) string { return path.Join(kind, name) },
+		file: func(kind, name, day string) string {
+			if day == "" {
+				return name
+			}
+			return day
+		},
+		byDay: true,
+	},
+}
+
+// dayGroup is the messages of one day of a conversation.
+type dayGroup struct {
+	day      string
+	messages []slack.Message
+}
+
+// splitByDay groups messages by the day they were posted on, keeping their
+// order. Without byDay, they all go in one group with no day. Messages whose
+// timestamp cannot be read go in a last group of their own, for the day
+// "unknown".
+func (l *layout) splitByDay(messages []slack.Message) []dayGroup {
+	if !l.byDay {
+		return []dayGroup{{"", messages}}
+	}
+	var groups []dayGroup
+	unknown := dayGroup{day: "unknown"}
+	for _, msg := range messages {
+		if !tsRE.MatchString(msg.Timestamp) {
+			unknown.messages = append(unknown.messages, msg)
+			continue
+		}
+		day := parseTimestamp(msg.Timestamp).Format("2006-01-02")
+		if len(groups) == 0 || groups[len(groups)-1].day != day {
+			groups = append(groups, dayGroup{day: day})
+		}
+		last := &groups[len(groups)-1]
+		last.messages = append(last.messages, msg)
+	}
+	if len(unknown.messages) > 0 {
+		groups = append(groups, unknown)
+	}
+	return groups
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// dateNames are the month and weekday names of a language, in full and
+// short, the way Go layouts spell them as January, Jan, Monday and Mon.
+type dateNames struct {
+	months      [12]string
+	shortMonths [12]string
+	days        [7]string // from Sunday, as time.Weekday counts
+	shortDays   [7]string
+}
+
+// locales are the languages --locale can show dates in. English, the first,
+// is what Go formats dates in, and needs no names of its own.
+var locales = []struct {
+	tag   language.Tag
+	names *dateNames
+}{
+	{language.English, nil},
+	{language.German, &dateNames{
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+	}},
+	{language.Spanish, &dateNames{
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	}},
+	{language.French, &dateNames{
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	}},
+	{language.Italian, &dateNames{
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	}},
+	{language.Dutch, &dateNames{
+		months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+		days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		shortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+	}},
+	{language.Portuguese, &dateNames{
+		months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		shortMonths: [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		days:        [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortDays:   [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	}},
+	{language.Swedish, &dateNames{
+		months:      [12]string{"januari", "februari", "mars", "april", "maj", "juni", "juli", "augusti", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan.", "feb.", "mars", "apr.", "maj", "juni", "juli", "aug.", "sep.", "okt.", "nov.", "dec."},
+		days:        [7]string{"söndag", "måndag", "tisdag", "onsdag", "torsdag", "fredag", "lördag"},
+		shortDays:   [7]string{"sön", "mån", "tis", "ons", "tors", "fre", "lör"},
+	}},
+}
+
+// findLocale returns the date names of the language closest to name, a
+// language tag such as de or pt-BR, and whether there is one.
+func findLocale(name string) (*dateNames, bool) {
+	tag, err := language.Parse(name)
+	if err != nil {
+		return nil, false
+	}
+	tags := make([]language.Tag, len(locales))
+	for i, locale := range locales {
+		tags[i] = locale.tag
+	}
+	_, i, confidence := language.NewMatcher(tags).Match(tag)
+	if confidence == language.No {
+		return nil, false
+	}
+	return locales[i].names, true
+}
+
+// formatDate formats t with layout, in the language of names. Go only
+// knows English names, so the month and weekday names of the layout are put
+// in here, each of its own kind, and the rest of it is left to Go.
+func formatDate(t time.Time, layout string, names *dateNames) string {
+	if names == nil {
+		return t.Format(layout)
+	}
+	month, day := t.Month()-1, t.Weekday()
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(layout); i++ {
+		name, n := "", 0
+		rest := layout[i:]
+		// Like Go, take Jan and Mon for names only when no lower case
+		// letter follows, so that a word such as Month stays as it is.
+		short := len(rest) == 3 || len(rest) > 3 && !('a' <= rest[3] && rest[3] <= 'z')
+		switch {
+		case strings.HasPrefix(rest, "January"):
+			name, n = names.months[month], len("January")
+		case strings.HasPrefix(rest, "Jan") && short:
+			name, n = names.shortMonths[month], len("Jan")
+		case strings.HasPrefix(rest, "Monday"):
+			name, n = names.days[day], len("Monday")
+		case strings.HasPrefix(rest, "Mon") && short:
+			name, n = names.shortDays[day], len("Mon")
+		default:
+			continue
+		}
+		b.WriteString(t.Format(layout[start:i]))
+		b.WriteString(name)
+		i += n - 1
+		start = i + 1
+	}
+	b.WriteString(t.Format(layout[start:]))
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	may := time.Date(2018, time.May, 7, 12, 0, 0, 0, time.UTC) // a Monday
+	tests := []struct {
+		locale string
+		layout string
+		want   string
+	}{
+		{"en", "Monday, Jan 2 2006", "Monday, May 7 2018"},
+		{"es", "Jan 2 2006", "may 7 2018"},
+		{"es", "January 2 2006", "mayo 7 2018"},
+		{"es", "Monday, Jan 2", "lunes, may 7"},
+		{"es", "Mon 2 January", "lun 7 mayo"},
+		{"de", "Mon, 2. Jan 2006", "Mo., 7. Mai 2018"},
+		{"fr", "Month: Jan", "Month: mai"},
+		{"sv", "2 Jan", "7 maj"},
+	}
+	for _, test := range tests {
+		names, ok := findLocale(test.locale)
+		if !ok {
+			t.Errorf("%s: no such locale", test.locale)
+			continue
+		}
+		if got := formatDate(may, test.layout, names); got != test.want {
+			t.Errorf("%s %q: got %q, want %q", test.locale, test.layout, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logConsole is the console side of the log: standard output, or standard
+// error when the archive goes to standard output.
+var logConsole io.Writer = os.Stdout
+
+// logOutput is where progress, warnings and errors go: the console and,
+// with --log-file, a file as well.
+var logOutput io.Writer = logConsole
+var logMutex sync.Mutex
+
+// logJSON is set by --log-json to write each log line as a JSON object.
+var logJSON bool
+
+// logDebug is set by --log-level debug to also write the debug lines,
+// such as how long each page of history took to fetch.
+var logDebug bool
+
+// logFields are the details of a log line that --log-json gives a field of
+// their own, such as the channel it is about.
+type logFields map[string]interface{}
+
+// logf writes one line to the log.
+func logf(format string, a ...interface{}) {
+	logWith(nil, format, a...)
+}
+
+// debugWith writes one debug line to the log, when debug lines are asked
+// for.
+func debugWith(fields logFields, format string, a ...interface{}) {
+	if logDebug {
+		logWith(fields, "DEBUG: "+format, a...)
+	}
+}
+
+// logWith writes one line to the log. Plain text lines are expected to
+// mention the fields already, so only JSON lines show them.
+func logWith(fields logFields, format string, a ...interface{}) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+	if !logJSON {
+		fmt.Fprintf(logOutput, format+"\n", a...)
+		return
+	}
+
+	message := fmt.Sprintf(format, a...)
+	entry := logFields{"level": "info"}
+	for _, level := range []string{"ERROR", "WARNING", "DEBUG"} {
+		if strings.HasPrefix(message, level+": ") {
+			entry["level"] = strings.ToLower(level)
+			message = strings.TrimPrefix(message, level+": ")
+		}
+	}
+	for name, value := range fields {
+		entry[name] = value
+	}
+	entry["time"] = time.Now().Format(time.RFC3339)
+	entry["message"] = strings.TrimSpace(message)
+
+	data, err := json.Marshal(entry)
+	check(err)
+	fmt.Fprintf(logOutput, "%s\n", data)
+}
+
+// openLogFile starts copying the log to the file at name.
+func openLogFile(name string) *os.File {
+	f, err := os.Create(name)
+	check(err)
+	logOutput = io.MultiWriter(logConsole, f)
+	return f
+}
+
+// copyLogFile puts a copy of the log file, as it stands, into the export.
+func copyLogFile(f *os.File, dir string) {
+	data, err := ioutil.ReadFile(f.Name())
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, filepath.Base(f.Name())), data, 0644)
+	check(err)
+}
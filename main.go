@@ -1,22 +1,29 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"html"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
-	"github.com/codegangsta/cli"
-	"github.com/jhoonb/archivex"
 	"github.com/nlopes/slack"
+	"github.com/urfave/cli/v2"
 )
 
 func check(e error) {
@@ -26,72 +33,929 @@ func check(e error) {
 }
 
 func main() {
+	defer exitOnPanic()
 	app := cli.NewApp()
 	app.Name = "slack-dump"
 	app.Usage = "export channel and group history to the Slack export format include Direct message"
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:   "token, t",
-			Value:  "",
-			Usage:  "a Slack API token: (see: https://api.slack.com/web)",
-			EnvVar: "SLACK_API_TOKEN",
+	app.ArgsUsage = dumpArgsUsage
+	app.Flags = append(append([]cli.Flag{}, clientFlags...), dumpFlags...)
+	app.Authors = []*cli.Author{
+		{Name: "Joe Fitzgerald", Email: "jfitzgerald@pivotal.io"},
+		{Name: "Sunyong Lim", Email: "dicebattle@gmail.com"},
+	}
+	app.Version = "0.0.2"
+	app.Commands = []*cli.Command{
+		{
+			Name:      "dump",
+			Usage:     "export channel, group and direct message history (what runs without a command)",
+			ArgsUsage: dumpArgsUsage,
+			Flags:     append(append([]cli.Flag{}, clientFlags...), dumpFlags...),
+			Action:    dump,
+		},
+		{
+			Name:   "list",
+			Usage:  "list the public and private channels the token can see",
+			Flags:  clientFlags,
+			Action: list,
+		},
+		{
+			Name:   "users",
+			Usage:  "list the users of the workspace",
+			Flags:  clientFlags,
+			Action: listUsers,
 		},
-		cli.BoolFlag{
-			Name:   "text, x",
-			Usage:  "Output plain text instead of json files.",
+		{
+			Name:   "check",
+			Usage:  "check that the token works, and print its workspace, user and scopes",
+			Flags:  clientFlags,
+			Action: checkToken,
+		},
+		{
+			Name:      "verify",
+			Usage:     "check an export (slackdump.zip, another zip or a directory) against the Slack export format",
+			ArgsUsage: "[export]",
+			Action:    verify,
+		},
+		{
+			Name:      "merge-users",
+			Usage:     "link the users of several workspaces' exports by email address into users-merged.json",
+			ArgsUsage: "<users.json> <users.json> ...",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "output",
+					Value: "users-merged.json",
+					Usage: "file to write the merged users to",
+				},
+			},
+			Action: mergeUsers,
+		},
+		{
+			Name:      "thread",
+			Usage:     "print the thread started at <ts> in <channel> as plain text",
+			ArgsUsage: "<channel> <ts>",
+			Flags:     append(append([]cli.Flag{}, clientFlags...), nameFieldFlag, dateFormatFlag, localeFlag, timeFormatFlag, emojiUnicodeFlag),
+			Action:    thread,
 		},
 	}
-	app.Author = "Joe Fitzgerald, Sunyong Lim"
-	app.Email = "jfitzgerald@pivotal.io, dicebattle@gmail.com"
-	app.Version = "0.0.2"
-	app.Action = func(c *cli.Context) {
-		token := c.String("token")
-		if token == "" {
-			fmt.Println("ERROR: the token flag is required...")
+	app.Action = dump
+
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(exitUsage)
+	}
+}
+
+// dumpArgsUsage tells what the arguments of a dump are: the channels,
+// private channels and users whose DMs to dump, %regexp for the channels
+// whose names match, links to conversations, or a lone @user for just the
+// DM with one user.
+const dumpArgsUsage = "[channel | %regexp | user | link ...] | @user"
+
+// clientFlags are the flags every command that talks to Slack takes.
+var clientFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "token",
+		Aliases: []string{"t"},
+		Value:   "",
+		Usage:   "a Slack API token: (see: https://api.slack.com/web)",
+		EnvVars: []string{"SLACK_API_TOKEN"},
+	},
+	&cli.StringFlag{
+		Name:    "api-url",
+		Value:   "",
+		Usage:   "base URL of the Slack API, for a proxy or a mock server",
+		EnvVars: []string{"SLACK_API_URL"},
+	},
+	&cli.StringFlag{
+		Name:  "proxy",
+		Value: "",
+		Usage: "send every request through this HTTP proxy instead of the one in HTTPS_PROXY",
+	},
+	&cli.BoolFlag{
+		Name:  "no-proxy",
+		Usage: "do not use the proxy in HTTPS_PROXY or HTTP_PROXY",
+	},
+	&cli.IntFlag{
+		Name:  "retry-budget",
+		Value: 100,
+		Usage: "give up once this many requests in all have had to be retried, or never with 0",
+	},
+	&cli.StringFlag{
+		Name:    "refresh-token-file",
+		Value:   "",
+		Usage:   "file holding the refresh token of a rotating token, which is updated as the token is refreshed",
+		EnvVars: []string{"SLACK_REFRESH_TOKEN_FILE"},
+	},
+	&cli.StringFlag{
+		Name:    "client-id",
+		Value:   "",
+		Usage:   "client ID of the Slack app, to refresh a rotating token",
+		EnvVars: []string{"SLACK_CLIENT_ID"},
+	},
+	&cli.StringFlag{
+		Name:    "client-secret",
+		Value:   "",
+		Usage:   "client secret of the Slack app, to refresh a rotating token",
+		EnvVars: []string{"SLACK_CLIENT_SECRET"},
+	},
+	&cli.StringFlag{
+		Name:  "debug-raw",
+		Value: "",
+		Usage: "save the body of every API answer, as Slack sent it, to a numbered file in this directory",
+	},
+}
+
+var nameFieldFlag = &cli.StringFlag{
+	Name:  "name-field",
+	Value: "real",
+	Usage: "user name shown in plain text output: display or real",
+}
+
+var dateFormatFlag = &cli.StringFlag{
+	Name:  "date-format",
+	Value: "Monday, Jan 2 2006",
+	Usage: "Go layout of the day separators in text, HTML and Markdown output",
+}
+
+var localeFlag = &cli.StringFlag{
+	Name:  "locale",
+	Value: "en",
+	Usage: "language of the month and weekday names of the day separators: en, de, es, fr, it, nl, pt or sv",
+}
+
+var timeFormatFlag = &cli.StringFlag{
+	Name:  "time-format",
+	Value: "15:04:05",
+	Usage: "Go layout of the message times in text, HTML and Markdown output",
+}
+
+var emojiUnicodeFlag = &cli.BoolFlag{
+	Name:  "emoji-unicode",
+	Usage: "show standard emoji shortcodes such as :smile: as the emoji in text and Markdown output",
+}
+
+// dumpFlags are the flags of the dump command.
+var dumpFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:    "text",
+		Aliases: []string{"x"},
+		Usage:   "Output plain text instead of json files.",
+	},
+	&cli.StringFlag{
+		Name:  "formats",
+		Value: "json",
+		Usage: "comma separated list of message file formats: json, text, html, md, csv, discord and mbox",
+	},
+	&cli.StringFlag{
+		Name:  "newline",
+		Value: "lf",
+		Usage: "line endings of the text, Markdown and CSV output: lf, or crlf for Windows",
+	},
+	&cli.StringFlag{
+		Name:  "fields",
+		Value: "",
+		Usage: "comma separated list of the message fields to keep in JSON output, e.g. ts,user,text,subtype",
+	},
+	&cli.StringFlag{
+		Name:  "layout",
+		Value: "slack",
+		Usage: "where message files go: slack (channel/general.json), flat, by-type or by-date",
+	},
+	nameFieldFlag,
+	dateFormatFlag,
+	localeFlag,
+	timeFormatFlag,
+	emojiUnicodeFlag,
+	&cli.BoolFlag{
+		Name:  "permalinks",
+		Usage: "follow each message of the text output with its link in Slack (only text: HTML and Markdown always link the times)",
+	},
+	&cli.IntFlag{
+		Name:  "max-channels",
+		Value: 0,
+		Usage: "dump at most this many channels and private channels, the first ones in name order (0 for all)",
+	},
+	&cli.StringFlag{
+		Name:  "resume-from-channel",
+		Value: "",
+		Usage: "skip direct messages and every channel up to and including this one (in name order)",
+	},
+	&cli.StringFlag{
+		Name:  "since",
+		Value: "",
+		Usage: "only dump messages from this date (2018-01-31) or time (RFC 3339) on",
+	},
+	&cli.IntFlag{
+		Name:  "since-days",
+		Usage: "only dump messages from the last this many days, unless since is given",
+	},
+	&cli.StringFlag{
+		Name:  "until",
+		Value: "",
+		Usage: "only dump messages up to this date (2018-01-31, included) or time (RFC 3339)",
+	},
+	&cli.StringFlag{
+		Name:  "since-message-ts",
+		Value: "",
+		Usage: "only dump messages posted after the one with this ts, e.g. the last one an earlier run got",
+	},
+	&cli.BoolFlag{
+		Name:  "inclusive",
+		Usage: "also dump the message at since-message-ts itself",
+	},
+	&cli.BoolFlag{
+		Name:  "include-reactions-detail",
+		Usage: "show who reacted to each message in the text and HTML output, and keep every reactor in the JSON",
+	},
+	&cli.IntFlag{
+		Name:  "limit-messages",
+		Usage: "only dump the newest this many messages of each channel and DM",
+	},
+	&cli.BoolFlag{
+		Name:  "replies",
+		Usage: "also dump the replies of threads, next to the other messages",
+	},
+	&cli.IntFlag{
+		Name:  "replies-depth",
+		Value: 0,
+		Usage: "with replies, only dump the first this many replies of each thread (0 for all)",
+	},
+	&cli.BoolFlag{
+		Name:  "merged-transcript",
+		Usage: "also write the messages of all the conversations dumped as one timeline to merged.txt",
+	},
+	&cli.IntFlag{
+		Name:  "recent-messages",
+		Usage: "also save the newest this many messages of all the channels and DMs together to recent.json",
+	},
+	&cli.BoolFlag{
+		Name:  "newest-first",
+		Usage: "write the messages of each channel and DM newest first",
+	},
+	&cli.StringFlag{
+		Name:  "previous-users",
+		Value: "",
+		Usage: "users.json of an earlier export, to list who was added, removed or changed since in users-diff.json",
+	},
+	&cli.BoolFlag{
+		Name:  "presence",
+		Usage: "record each user's current presence in users.json (one API call per user)",
+	},
+	&cli.BoolFlag{
+		Name:  "custom-fields",
+		Usage: "record each user's custom profile fields, such as department or manager, in users.json (one API call per user)",
+	},
+	&cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "stop dumping after this long, e.g. 2h, and archive what was dumped until then (0 for no limit)",
+	},
+	&cli.DurationFlag{
+		Name:  "delay",
+		Usage: "time to wait between channels, e.g. 5s",
+	},
+	&cli.StringFlag{
+		Name:  "user-filter",
+		Value: "",
+		Usage: "only keep messages written by or mentioning this user",
+	},
+	&cli.BoolFlag{
+		Name:  "only-my-messages",
+		Usage: "only keep the messages written by the token's user, for personal data exports",
+	},
+	&cli.BoolFlag{
+		Name:  "fail-fast",
+		Usage: "stop at the first channel or DM that cannot be dumped (the default)",
+	},
+	&cli.BoolFlag{
+		Name:  "continue-on-error",
+		Usage: "leave out the channels and DMs that cannot be dumped, list them in warnings.json, and go on",
+	},
+	&cli.BoolFlag{
+		Name:  "validate",
+		Usage: "check the export against the Slack export format before archiving it",
+	},
+	&cli.IntFlag{
+		Name:  "concurrency",
+		Value: 1,
+		Usage: "number of channels and DMs to dump at the same time",
+	},
+	&cli.IntFlag{
+		Name:  "download-workers",
+		Value: 4,
+		Usage: "number of files to download at the same time, from all the channels and DMs being dumped",
+	},
+	&cli.IntFlag{
+		Name:  "min-messages",
+		Usage: "leave out channels and DMs with fewer messages than this to write, after the other filters",
+	},
+	&cli.BoolFlag{
+		Name:  "stars",
+		Usage: "also save the token owner's starred items to stars.json",
+	},
+	&cli.BoolFlag{
+		Name:  "reminders",
+		Usage: "also save the token owner's reminders to reminders.json",
+	},
+	&cli.BoolFlag{
+		Name:  "events",
+		Usage: "save the pins and reactions on each channel's messages to <channel>.events.json",
+	},
+	&cli.BoolFlag{
+		Name:  "membership",
+		Usage: "save who joined and left each channel and when to <channel>.membership.json",
+	},
+	&cli.StringFlag{
+		Name:  "log-file",
+		Value: "",
+		Usage: "also write the log to this file, and put a copy of it in the archive",
+	},
+	&cli.BoolFlag{
+		Name:  "log-json",
+		Usage: "write each log line as a JSON object with its level, time and details",
+	},
+	&cli.StringFlag{
+		Name:  "log-level",
+		Value: "info",
+		Usage: "info, or debug to also log how long each page of history took to fetch",
+	},
+	&cli.BoolFlag{
+		Name:  "preserve-json-unescaped",
+		Usage: "write JSON files with Go's standard escaping instead of Slack's (\\/ and plain < > &)",
+	},
+	&cli.IntFlag{
+		Name:  "compress-level",
+		Value: 6,
+		Usage: "zip compression level, from 0 (store only) to 9 (smallest)",
+	},
+	&cli.BoolFlag{
+		Name:  "archive-to-stdout",
+		Usage: "write the archive to standard output instead of slackdump.zip, and the log to standard error",
+	},
+	&cli.StringFlag{
+		Name:  "split-size",
+		Value: "",
+		Usage: "cut the archive into numbered parts of at most this size, e.g. 2GB",
+	},
+	&cli.BoolFlag{
+		Name:  "no-dms",
+		Usage: "do not dump direct messages",
+	},
+	&cli.BoolFlag{
+		Name:  "no-channels",
+		Usage: "do not dump public channels",
+	},
+	&cli.BoolFlag{
+		Name:  "no-groups",
+		Usage: "do not dump private channels",
+	},
+	&cli.BoolFlag{
+		Name:  "no-mpims",
+		Usage: "do not dump multi-party direct messages",
+	},
+	&cli.BoolFlag{
+		Name:  "dump-mpim-names",
+		Usage: "name the files of multi-party direct messages after their members, e.g. alice-bob-carol",
+	},
+	&cli.BoolFlag{
+		Name:  "no-bots",
+		Usage: "leave out the messages posted by bots and apps",
+	},
+	&cli.StringSliceFlag{
+		Name:  "channel-prefix",
+		Usage: "also dump the channels whose names start with this, e.g. proj- (can be repeated)",
+	},
+	&cli.BoolFlag{
+		Name:  "member-only",
+		Usage: "only dump the public channels the token's user is a member of",
+	},
+	&cli.BoolFlag{
+		Name:  "join-channels",
+		Usage: "with a bot token, have the bot join the public channels to dump that it is not in",
+	},
+	&cli.BoolFlag{
+		Name:  "files",
+		Usage: "download the files attached to messages into files/",
+	},
+	&cli.BoolFlag{
+		Name:  "thumbnails-only",
+		Usage: "download a thumbnail of each attached file into files/ instead of the file",
+	},
+	&cli.BoolFlag{
+		Name:  "bookmarks",
+		Usage: "save each channel's bookmarks and canvas reference to <channel>.bookmarks.json",
+	},
+	&cli.BoolFlag{
+		Name:  "team-info",
+		Usage: "save the workspace's name, domain and icons to team.json",
+	},
+	&cli.StringFlag{
+		Name:  "dir",
+		Value: "",
+		Usage: "build the export in this directory instead of a temporary one, carrying on partial file downloads found there",
+	},
+}
+
+// tokenFrom returns the token given to the command or to the app, and
+// exits with the usage help when there is none.
+func tokenFrom(c *cli.Context) string {
+	token := flagFrom(c, "token")
+	if token == "" {
+		fmt.Println("ERROR: the token flag is required...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	return token
+}
+
+// localeFrom returns the date names of the language given by --locale, and
+// exits with the usage help when there are none for it.
+func localeFrom(c *cli.Context) *dateNames {
+	names, ok := findLocale(c.String("locale"))
+	if !ok {
+		fmt.Println("ERROR: the locale flag must be one of en, de, es, fr, it, nl, pt or sv...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	return names
+}
+
+// layoutFrom returns the time layout given by the named flag, and exits
+// with the usage help when it is not one. A layout must hold at least one
+// element, and what it formats must parse back.
+func layoutFrom(c *cli.Context, name string) string {
+	layout := c.String(name)
+	sample := time.Date(2019, time.December, 25, 21, 47, 38, 0, time.UTC).Format(layout)
+	if _, err := time.Parse(layout, sample); err != nil || sample == layout {
+		fmt.Println("ERROR: the " + name + " flag must be a Go time layout, such as \"Jan 2 2006\" or \"15:04\"...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	return layout
+}
+
+// dateFrom returns the Slack timestamp of the date or time given by the
+// named flag, or "" when the flag is not set, and exits with the usage help
+// when it is neither a date (2006-01-02) nor an RFC 3339 time. A date stands
+// for its start, or for its end when endOfDay is set.
+func dateFrom(c *cli.Context, name string, endOfDay bool) string {
+	value := c.String(name)
+	if value == "" {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		if err == nil && endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	if err != nil {
+		fmt.Println("ERROR: the " + name + " flag must be a date such as 2018-01-31 or a time such as 2018-01-31T12:00:00Z...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// flagFrom returns the named client flag as given to the command or to the
+// app.
+func flagFrom(c *cli.Context, name string) string {
+	return flagContext(c, name).String(name)
+}
+
+// flagContext returns the context the named flag was given in: the
+// command's or the app's, as both take the client flags. It is c when the
+// flag was given to neither, so that its default applies.
+func flagContext(c *cli.Context, name string) *cli.Context {
+	for _, ctx := range c.Lineage() {
+		if ctx.IsSet(name) {
+			return ctx
+		}
+	}
+	return c
+}
+
+// tsRE matches a Slack message timestamp.
+var tsRE = regexp.MustCompile(`^[0-9]+(\.[0-9]{1,6})?$`)
+
+// tsBefore returns the timestamp one microsecond before ts, which lets an
+// exclusive bound take in the message at ts. Slack's own inclusive option
+// would apply to the paging bound too and repeat a message on every page.
+func tsBefore(ts string) string {
+	t := tsMicros(ts) - 1
+	if t < 0 {
+		t = 0
+	}
+	return fmt.Sprintf("%d.%06d", t/1000000, t%1000000)
+}
+
+// tsMicros returns ts, a Slack timestamp, in microseconds.
+func tsMicros(ts string) int64 {
+	secs, micros := ts, "0"
+	if i := strings.Index(ts, "."); i >= 0 {
+		secs, micros = ts[:i], (ts[i+1:] + "000000")[:6]
+	}
+	s, _ := strconv.ParseInt(secs, 10, 64)
+	us, _ := strconv.ParseInt(micros, 10, 64)
+	return s*1000000 + us
+}
+
+// inPeriod reports whether ts falls between opts.oldest and opts.latest,
+// which Slack treats as exclusive bounds.
+func inPeriod(ts string, opts *options) bool {
+	t := tsMicros(ts)
+	return (opts.oldest == "" || t > tsMicros(opts.oldest)) && (opts.latest == "" || t < tsMicros(opts.latest))
+}
+
+// keptInPeriod reports whether msg belongs in a dump of the period between
+// opts.oldest and opts.latest: it was posted in it, or it is a reply in a
+// thread that was started in it, which --replies fetches whole.
+func keptInPeriod(msg slack.Message, opts *options) bool {
+	if inPeriod(msg.Timestamp, opts) {
+		return true
+	}
+	return msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp && inPeriod(msg.ThreadTimestamp, opts)
+}
+
+// apiURLFrom returns the base URL of the Slack API given to the command or
+// to the app, ending in a slash.
+func apiURLFrom(c *cli.Context) string {
+	apiURL := flagFrom(c, "api-url")
+	if apiURL == "" {
+		return defaultAPIURL
+	}
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+	return apiURL
+}
+
+// newClient connects to Slack, and exits when the token is refused.
+func newClient(c *cli.Context, token string) (*slack.Client, *slack.AuthTestResponse) {
+	setupProxy(c)
+	if dir := flagFrom(c, "debug-raw"); dir != "" {
+		saveRawResponses(dir, apiURLFrom(c))
+	}
+	retryBudget = int64(flagContext(c, "retry-budget").Int("retry-budget"))
+	if refreshFile := flagFrom(c, "refresh-token-file"); refreshFile != "" {
+		if flagFrom(c, "client-id") == "" || flagFrom(c, "client-secret") == "" {
+			fmt.Println("ERROR: the refresh-token-file flag needs the client-id and client-secret flags...")
+			fmt.Println("")
+			cli.ShowAppHelp(c)
+			os.Exit(exitUsage)
+		}
+		refresher = &tokenRefresher{
+			token:        token,
+			refreshFile:  refreshFile,
+			clientID:     flagFrom(c, "client-id"),
+			clientSecret: flagFrom(c, "client-secret"),
+			apiURL:       apiURLFrom(c),
+		}
+	}
+	clientOptions := []slack.Option{
+		slack.OptionHTTPClient(&http.Client{Transport: withTokenRefresh(retryingTransport{countingTransport{baseTransport}})}),
+	}
+	if apiURL := apiURLFrom(c); apiURL != defaultAPIURL {
+		clientOptions = append(clientOptions, slack.OptionAPIURL(apiURL))
+	}
+	api := slack.New(token, clientOptions...)
+	auth, err := api.AuthTest()
+	if err != nil && exitCode(err) == exitNetwork {
+		logf("ERROR: could not reach Slack: %v", err)
+		os.Exit(exitNetwork)
+	}
+	if err != nil {
+		logf("ERROR: the token you used is not valid...")
+		os.Exit(exitAuth)
+	}
+	return api, auth
+}
+
+// dump exports the history of the conversations named by the arguments,
+// or of all of them.
+func dump(c *cli.Context) error {
+	token := tokenFrom(c)
+	opts := &options{
+		nameField:       c.String("name-field"),
+		channelPrefixes: c.StringSlice("channel-prefix"),
+		dateFormat:      layoutFrom(c, "date-format"),
+		locale:          localeFrom(c),
+		timeFormat:      layoutFrom(c, "time-format"),
+		resumeFrom:      c.String("resume-from-channel"),
+		maxChannels:     c.Int("max-channels"),
+		oldest:          dateFrom(c, "since", false),
+		latest:          dateFrom(c, "until", true),
+		limitMessages:   c.Int("limit-messages"),
+		recentMessages:  c.Int("recent-messages"),
+		merged:          c.Bool("merged-transcript"),
+		replies:         c.Bool("replies"),
+		repliesDepth:    c.Int("replies-depth"),
+		newestFirst:     c.Bool("newest-first"),
+		presence:        c.Bool("presence"),
+		customFields:    c.Bool("custom-fields"),
+		delay:           c.Duration("delay"),
+		userFilter:      c.String("user-filter"),
+		onlyMine:        c.Bool("only-my-messages"),
+		concurrency:     c.Int("concurrency"),
+		minMessages:     c.Int("min-messages"),
+		events:          c.Bool("events"),
+		membership:      c.Bool("membership"),
+		compressLevel:   c.Int("compress-level"),
+		noDMs:           c.Bool("no-dms"),
+		noChannels:      c.Bool("no-channels"),
+		noGroups:        c.Bool("no-groups"),
+		noMPIMs:         c.Bool("no-mpims"),
+		mpimNames:       c.Bool("dump-mpim-names"),
+		noBots:          c.Bool("no-bots"),
+		memberOnly:      c.Bool("member-only"),
+		joinChannels:    c.Bool("join-channels"),
+		permalinks:      c.Bool("permalinks"),
+		emojiUnicode:    c.Bool("emoji-unicode"),
+		reactionsDetail: c.Bool("include-reactions-detail"),
+		continueOnError: c.Bool("continue-on-error"),
+		downloadFiles:   c.Bool("files"),
+		thumbnailsOnly:  c.Bool("thumbnails-only"),
+		bookmarks:       c.Bool("bookmarks"),
+		token:           token,
+		apiURL:          apiURLFrom(c),
+	}
+	if opts.nameField != "display" && opts.nameField != "real" {
+		fmt.Println("ERROR: the name-field flag must be display or real...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	if ts := c.String("since-message-ts"); ts != "" {
+		if !tsRE.MatchString(ts) || opts.oldest != "" {
+			fmt.Println("ERROR: the since-message-ts flag must be a message ts such as 1514764800.000200, and cannot go with since...")
 			fmt.Println("")
 			cli.ShowAppHelp(c)
-			os.Exit(2)
+			os.Exit(exitUsage)
 		}
-		textOutput := c.Bool("text")
-		roomsOrUsers := c.Args()
-		api := slack.New(token)
-		_, err := api.AuthTest()
+		opts.oldest = ts
+		if c.Bool("inclusive") {
+			opts.oldest = tsBefore(ts)
+		}
+	}
+	if days := c.Int("since-days"); days < 0 {
+		fmt.Println("ERROR: the since-days flag must be a number of days...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	} else if days > 0 && opts.oldest == "" {
+		// --since and --since-message-ts are more precise, and win.
+		opts.oldest = strconv.FormatInt(time.Now().Add(-time.Duration(days)*24*time.Hour).Unix(), 10)
+	}
+	if opts.repliesDepth < 0 || (opts.repliesDepth > 0 && !opts.replies) {
+		fmt.Println("ERROR: the replies-depth flag must be a number of replies, and needs the replies flag...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	if size := c.String("split-size"); size != "" {
+		splitSize, err := parseSize(size)
 		if err != nil {
-			fmt.Println("ERROR: the token you used is not valid...")
-			os.Exit(2)
+			fmt.Println("ERROR: the split-size flag must be a size such as 500MB or 2GB...")
+			fmt.Println("")
+			cli.ShowAppHelp(c)
+			os.Exit(exitUsage)
 		}
+		opts.splitSize = splitSize
+	}
+	if opts.downloadFiles && opts.thumbnailsOnly {
+		fmt.Println("ERROR: the files and thumbnails-only flags cannot go together...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	if opts.onlyMine && opts.userFilter != "" {
+		fmt.Println("ERROR: the only-my-messages and user-filter flags cannot go together...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	if c.Bool("fail-fast") && opts.continueOnError {
+		fmt.Println("ERROR: the fail-fast and continue-on-error flags cannot go together...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	if opts.compressLevel < 0 || opts.compressLevel > 9 {
+		fmt.Println("ERROR: the compress-level flag must be between 0 and 9...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	if name := c.String("previous-users"); name != "" {
+		users, err := readUsersFile(name)
+		if err != nil {
+			fmt.Println("ERROR: the previous-users flag must name the users.json of an export: " + err.Error())
+			fmt.Println("")
+			cli.ShowAppHelp(c)
+			os.Exit(exitUsage)
+		}
+		opts.previousUsers = users
+	}
+	downloadWorkers := c.Int("download-workers")
+	if downloadWorkers < 1 {
+		fmt.Println("ERROR: the download-workers flag must be at least 1...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	downloadSlots = make(chan struct{}, downloadWorkers)
+	switch c.String("newline") {
+	case "lf":
+	case "crlf":
+		opts.crlf = true
+	default:
+		fmt.Println("ERROR: the newline flag must be lf or crlf...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	opts.layout = layouts[c.String("layout")]
+	if opts.layout == nil {
+		fmt.Println("ERROR: the layout flag must be slack, flat, by-type or by-date...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	for _, format := range strings.Split(c.String("formats"), ",") {
+		format = strings.TrimSpace(format)
+		if !knownFormat(format) {
+			fmt.Println("ERROR: unknown format " + format + " in the formats flag...")
+			fmt.Println("")
+			cli.ShowAppHelp(c)
+			os.Exit(exitUsage)
+		}
+		opts.formats = append(opts.formats, format)
+	}
+	if fields := c.String("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				opts.fields = append(opts.fields, field)
+			}
+		}
+	}
+	if c.Bool("text") && !strings.Contains(c.String("formats"), "text") {
+		opts.formats = append(opts.formats, "text")
+	}
+	if c.Bool("archive-to-stdout") {
+		if opts.splitSize > 0 {
+			fmt.Println("ERROR: the archive-to-stdout and split-size flags cannot go together...")
+			fmt.Println("")
+			cli.ShowAppHelp(c)
+			os.Exit(exitUsage)
+		}
+		logConsole = os.Stderr
+		logOutput = logConsole
+	}
+	if timeout := c.Duration("timeout"); timeout > 0 {
+		startDeadline(timeout)
+	}
+	logJSON = c.Bool("log-json")
+	switch c.String("log-level") {
+	case "info":
+	case "debug":
+		logDebug = true
+	default:
+		fmt.Println("ERROR: the log-level flag must be info or debug...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	plainJSON = c.Bool("preserve-json-unescaped")
+	var logFile *os.File
+	if name := c.String("log-file"); name != "" {
+		logFile = openLogFile(name)
+		defer logFile.Close()
+	}
+	roomsOrUsers := c.Args().Slice()
+	for _, room := range roomsOrUsers {
+		if _, err := path.Match(room, ""); isGlob(room) && err != nil {
+			fmt.Printf("ERROR: %s is not a valid pattern...\n", room)
+			fmt.Println("")
+			cli.ShowAppHelp(c)
+			os.Exit(exitUsage)
+		}
+		if _, err := regexp.Compile(strings.TrimPrefix(room, "%")); strings.HasPrefix(room, "%") && err != nil {
+			fmt.Printf("ERROR: %s is not a valid regular expression: %v...\n", room, err)
+			fmt.Println("")
+			cli.ShowAppHelp(c)
+			os.Exit(exitUsage)
+		}
+	}
+	if raw := flagFrom(c, "debug-raw"); raw != "" && c.String("dir") != "" && insideDir(raw, c.String("dir")) {
+		fmt.Println("ERROR: the debug-raw directory cannot be inside the dir directory, whose files go in the archive...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+	api, auth := newClient(c, token)
+	opts.teamID = auth.TeamID
+	opts.teamURL = auth.URL
+	opts.teamName = auth.Team
+	opts.selfID = auth.UserID
+	opts.botToken = isBotToken(opts)
+	if opts.joinChannels && !opts.botToken {
+		logf("WARNING: the join-channels flag is only for bot tokens, a user token reads the channels it is not in already")
+	}
+	if opts.botToken && !opts.joinChannels && !opts.memberOnly {
+		addWarning("this is a bot token, which only reads the channels the bot is in, so only those are dumped; --join-channels has the bot join the others")
+		opts.memberOnly = true
+	}
+	opts.userGroups = fetchUserGroups(api)
 
-		// Create working directory
-		dir, err := ioutil.TempDir("", "slack-dump")
+	// Create working directory
+	var err error
+	dir := c.String("dir")
+	if dir == "" {
+		dir, err = ioutil.TempDir("", "slack-dump")
+		check(err)
+	} else {
+		err = os.MkdirAll(dir, 0755)
 		check(err)
+		// Windows limits paths to 260 characters unless they start with \\?\,
+		// which Go's os package does for us, but only for absolute paths.
+		dir, err = filepath.Abs(dir)
+		check(err)
+	}
+
+	if c.Bool("team-info") && !timedOut() {
+		dumpTeamInfo(api, dir)
+	}
 
+	if len(roomsOrUsers) == 1 && len(roomsOrUsers[0]) > 1 && roomsOrUsers[0][0] == '@' {
+		dumpSingleDM(api, dir, roomsOrUsers[0][1:], auth.UserID, opts)
+	} else {
 		// Dump Users
-		usersMap := dumpUsers(api, dir, roomsOrUsers, textOutput)
+		usersMap := dumpUsers(api, dir, roomsOrUsers, opts)
 
 		// Dump Channels and Groups
-		dumpRooms(api, dir, roomsOrUsers, usersMap, textOutput)
+		dumpRooms(api, dir, roomsOrUsers, usersMap, opts)
+	}
 
-		archive(dir)
+	if len(opts.fields) > 0 {
+		warnMissingFields(opts)
 	}
 
-	app.Run(os.Args)
-}
+	if c.Bool("stars") && !timedOut() {
+		dumpStars(api, dir)
+	}
 
-func archive(dir string) {
-	zip := new(archivex.ZipFile)
-	pwd, err := os.Getwd()
-	check(err)
-	zip.Create(path.Join(pwd, "slackdump.zip"))
-	zip.AddAll(dir, true)
-	zip.Close()
+	if c.Bool("reminders") && !timedOut() {
+		dumpReminders(dir, opts)
+	}
+
+	if opts.downloadFiles || opts.thumbnailsOnly {
+		checkFiles(dir)
+	}
+
+	if c.Bool("validate") {
+		validateExport(dir)
+	}
+
+	writeWarnings(dir)
+	writeRenderWarnings(dir)
+	stats.writeStats(dir)
+	stats.writeReport(dir)
+
+	if logFile != nil {
+		copyLogFile(logFile, dir)
+	}
+
+	var archiveOut io.Writer
+	if c.Bool("archive-to-stdout") {
+		archiveOut = os.Stdout
+	}
+	archive(dir, opts.compressLevel, opts.splitSize, archiveOut)
+	cancelRun()
+
+	stats.printSummary()
+	if stoppedByTimeout {
+		logf("ERROR: the run's timeout was reached, the archive holds what was dumped until then")
+		os.Exit(exitTimeout)
+	}
+	if stats.report().Errors > 0 {
+		os.Exit(exitPartial)
+	}
+	return nil
 }
 
+// plainJSON is set by --preserve-json-unescaped to write JSON files the way
+// encoding/json does, for parsers that do not take Slack's escaping.
+var plainJSON bool
+
 // MarshalIndent is like json.MarshalIndent but applies Slack's weird JSON
-// escaping rules to the output.
+// escaping rules to the output, unless plainJSON is set.
 func MarshalIndent(v interface{}, prefix string, indent string) ([]byte, error) {
 	b, err := json.MarshalIndent(v, "", "    ")
-	if err != nil {
-		return nil, err
+	if err != nil || plainJSON {
+		return b, err
 	}
 
 	b = bytes.Replace(b, []byte("\\u003c"), []byte("<"), -1)
@@ -102,33 +966,277 @@ func MarshalIndent(v interface{}, prefix string, indent string) ([]byte, error)
 	return b, nil
 }
 
+// writeUsersFile writes users to the file at name as MarshalIndent would,
+// but one user at a time, so that the JSON of a directory of tens of
+// thousands of users never has to be held in memory all at once.
+func writeUsersFile(name string, users []slack.User) error {
+	if len(users) == 0 {
+		data, err := MarshalIndent(users, "", "    ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(name, data, 0644)
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString("[\n")
+	for i := range users {
+		data, err := MarshalIndent(&users[i], "", "    ")
+		if err != nil {
+			f.Close()
+			return err
+		}
+		// Nest the user one level down. Newlines only ever come between
+		// values, since those in strings are escaped.
+		w.WriteString("    ")
+		w.Write(bytes.Replace(data, []byte("\n"), []byte("\n    "), -1))
+		if i < len(users)-1 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n")
+	}
+	w.WriteString("]")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// options holds the settings that control what is dumped and how it is
+// rendered. It is filled in from the command line flags in main.
+type options struct {
+	formats         []string
+	fields          []string
+	layout          *layout
+	crlf            bool
+	channelPrefixes []string
+	nameField       string
+	dateFormat      string
+	locale          *dateNames
+	timeFormat      string
+	resumeFrom      string
+	maxChannels     int
+	channelsTaken   int
+	oldest          string
+	latest          string
+	limitMessages   int
+	recentMessages  int
+	merged          bool
+	replies         bool
+	repliesDepth    int
+	newestFirst     bool
+	presence        bool
+	customFields    bool
+	delay           time.Duration
+	userFilter      string
+	onlyMine        bool
+	concurrency     int
+	minMessages     int
+	events          bool
+	membership      bool
+	compressLevel   int
+	splitSize       int64
+	noDMs           bool
+	noChannels      bool
+	noGroups        bool
+	noMPIMs         bool
+	mpimNames       bool
+	noBots          bool
+	memberOnly      bool
+	joinChannels    bool
+	permalinks      bool
+	emojiUnicode    bool
+	reactionsDetail bool
+	continueOnError bool
+	downloadFiles   bool
+	thumbnailsOnly  bool
+	bookmarks       bool
+	token           string
+	apiURL          string
+
+	// teamID is the token's workspace, as reported by AuthTest.
+	teamID string
+	// teamURL and teamName are the workspace's address and name, as
+	// reported by AuthTest.
+	teamURL  string
+	teamName string
+	// selfID is the token's user, as reported by AuthTest.
+	selfID string
+	// botToken is set when the token is a bot's, which only reads the
+	// channels the bot is in.
+	botToken bool
+	// userFilterID is the ID of the userFilter user, looked up by dumpUsers.
+	userFilterID string
+	// userGroups maps the workspace's user group IDs to their handles.
+	userGroups map[string]string
+	// previousUsers are the users of the --previous-users file, or nil.
+	previousUsers []slack.User
+}
+
 type UserInfo struct {
 	Login string
 	RealName string
+	DisplayName string
+
+	// External is set for users of other workspaces met in shared channels.
+	External bool
+	// Unknown is set for users Slack would not tell us about, who are
+	// shown by their ID.
+	Unknown bool
+}
+
+// Label returns the name to show for the user, as selected by field. The
+// display name falls back to the real name when the user has not set one.
+func (u *UserInfo) Label(field string) string {
+	label := u.RealName
+	if field == "display" && u.DisplayName != "" {
+		label = u.DisplayName
+	}
+	if u.External {
+		label += " [external]"
+	}
+	return label
 }
 
 type UsersMap map[string]*UserInfo
 
-func dumpUsers(api *slack.Client, dir string, requestedUsers []string, textOutput bool) UsersMap {
-	fmt.Println("dump user information")
-	users, err := api.GetUsers()
-	check(err)
+// usersMapMutex guards the users map, which workers add to when they come
+// across users from other workspaces.
+var usersMapMutex sync.RWMutex
+
+func (m UsersMap) get(ID string) (*UserInfo, bool) {
+	usersMapMutex.RLock()
+	defer usersMapMutex.RUnlock()
+	user, ok := m[ID]
+	return user, ok
+}
+
+// resolveExternalUsers adds the authors and mentioned users of messages
+// that are missing from the users map, which only holds our own workspace.
+// They are looked up one by one; those Slack won't tell us about are kept
+// under their ID so that they are only asked for once.
+func resolveExternalUsers(api *slack.Client, messages []slack.Message, usersMap UsersMap, teamID string) {
+	for _, msg := range messages {
+		IDs := []string{msg.User}
+		for _, mention := range mentionRE.FindAllString(msg.Text, -1) {
+			IDs = append(IDs, mention[2:len(mention)-1])
+		}
+
+		for _, ID := range IDs {
+			if _, ok := usersMap.get(ID); ok || ID == "" {
+				continue
+			}
 
-	data, err := MarshalIndent(users, "", "    ")
+			info := &UserInfo{Login: ID, RealName: ID, External: true, Unknown: true}
+			sleepBeforeFetchIfNeeded()
+			if user, err := api.GetUserInfo(ID); err == nil {
+				info = &UserInfo{
+					Login:       user.Name,
+					RealName:    user.RealName,
+					DisplayName: user.Profile.DisplayName,
+					External:    user.TeamID != teamID,
+				}
+			}
+			usersMapMutex.Lock()
+			usersMap[ID] = info
+			usersMapMutex.Unlock()
+		}
+	}
+}
+
+// fetchUserGroups returns the handles of the workspace's user groups by
+// ID, for the group mentions that come without one. A token without the
+// usergroups:read scope gets none, and those mentions keep their ID.
+func fetchUserGroups(api *slack.Client) map[string]string {
+	handles := make(map[string]string)
+	sleepBeforeFetchIfNeeded()
+	groups, err := api.GetUserGroups()
+	if err != nil {
+		logf("could not get the user groups (%v), mentions of them may show their ID", err)
+		return handles
+	}
+	for _, group := range groups {
+		handles[group.ID] = group.Handle
+	}
+	return handles
+}
+
+// usersPageSize is how many users are asked for at once. Slack hands large
+// workspaces out in pages, and answers at most 1000 a page.
+const usersPageSize = 1000
+
+// fetchUsers gets every user of the workspace, page by page.
+func fetchUsers(api *slack.Client) ([]slack.User, error) {
+	var users []slack.User
+	page := api.GetUsersPaginated(slack.GetUsersOptionLimit(usersPageSize))
+	var err error
+	for err == nil {
+		sleepBeforeFetchIfNeeded()
+		page, err = page.Next(context.Background())
+		if err == nil {
+			users = append(users, page.Users...)
+			if len(users) > usersPageSize {
+				logf("  %d users so far", len(users))
+			}
+		}
+	}
+	// Failure tells the end of the pages from an error.
+	return users, page.Failure(err)
+}
+
+func dumpUsers(api *slack.Client, dir string, requestedUsers []string, opts *options) UsersMap {
+	logf("dump user information")
+	users, err := fetchUsers(api)
 	check(err)
-	err = ioutil.WriteFile(path.Join(dir, "users.json"), data, 0644)
+
+	// Status text and emoji come with each profile; presence has to be asked
+	// for user by user.
+	if opts.presence {
+		logf("dump user presence")
+		for i := range users {
+			if users[i].Deleted {
+				continue
+			}
+			if timedOut() {
+				break
+			}
+			sleepBeforeFetchIfNeeded()
+			presence, err := api.GetUserPresence(users[i].ID)
+			check(err)
+			users[i].Presence = presence.Presence
+		}
+	}
+
+	if opts.customFields {
+		logf("dump user custom profile fields")
+		addCustomFields(api, users, opts)
+	}
+
+	err = writeUsersFile(path.Join(dir, "users.json"), users)
 	check(err)
+	if opts.previousUsers != nil {
+		writeUsersDiff(dir, opts.previousUsers, users)
+	}
 
-	fmt.Println("dump direct message")
+	logf("dump direct message")
 	ims, err := api.GetIMChannels()
 	//fmt.Println(ims)
 
 	var usersToDump [] slack.User
 
 	if len(requestedUsers) > 0 && requestedUsers[0] != "@" {
+		imUsers := make(map[string]string, len(ims))
+		for _, im := range ims {
+			imUsers[im.ID] = im.User
+		}
 		usersToDump = FilterUsers(users, func(user slack.User) bool {
 			for _, rUser := range requestedUsers {
-				if rUser == user.Name {
+				if rUser == user.Name || imUsers[roomID(rUser)] == user.ID {
 					return true
 				}
 			}
@@ -138,31 +1246,67 @@ func dumpUsers(api *slack.Client, dir string, requestedUsers []string, textOutpu
 		usersToDump = users
 	}
 
-	usersMap := make(UsersMap)
-	for _, user := range users {
-		usersMap[user.ID] = &UserInfo { user.Name, user.RealName }
+	usersMap := buildUsersMap(users, opts)
+
+	// DMs are dumped before any channel, so a resumed run has already got them.
+	if opts.resumeFrom != "" || opts.noDMs {
+		usersToDump = nil
 	}
 
+	var dms []*ChannelMeta
 	for _, im := range ims {
 		for _, user := range usersToDump {
 			if im.User == user.ID{
-				fmt.Println("dump DM with " + user.Name)
-				dumpChannel(api, dir, im.ID, user.Name, "dm", usersMap, textOutput)
+				dms = append(dms, imMeta(im, user.Name))
 			}
 		}
 	}
 
+	sort.Sort(byMetaName(dms))
+	forEach(len(dms), opts.concurrency, 0, func(i int) {
+		logWith(logFields{"channel": dms[i].Name}, "dump DM with %s (%d/%d)", dms[i].Name, i+1, len(dms))
+		dumpConversation(api, dir, dms[i], usersMap, opts)
+	})
+
 	return usersMap
 }
 
-func dumpRooms(api *slack.Client, dir string, rooms []string, usersMap UsersMap, textOutput bool) {
+// buildUsersMap indexes users by ID and looks up the user-filter user.
+func buildUsersMap(users []slack.User, opts *options) UsersMap {
+	usersMap := make(UsersMap)
+	for _, user := range users {
+		usersMap[user.ID] = &UserInfo{Login: user.Name, RealName: user.RealName, DisplayName: user.Profile.DisplayName}
+		if opts.userFilter != "" && user.Name == opts.userFilter {
+			opts.userFilterID = user.ID
+		}
+	}
+
+	if opts.userFilter != "" && opts.userFilterID == "" {
+		logf("ERROR: the user-filter user %s does not exist...", opts.userFilter)
+		os.Exit(exitUsage)
+	}
+
+	return usersMap
+}
+
+func dumpRooms(api *slack.Client, dir string, rooms []string, usersMap UsersMap, opts *options) {
 	// Dump Channels
-	fmt.Println("dump public channel")
-	channels := dumpChannels(api, dir, rooms, usersMap, textOutput)
+	var channels []slack.Channel
+	if !opts.noChannels {
+		logf("dump public channel")
+		channels = dumpChannels(api, dir, rooms, usersMap, opts)
+	}
 
 	// Dump Private Groups
-	fmt.Println("dump private channel")
-	groups := dumpGroups(api, dir, rooms, usersMap, textOutput)
+	var groups []slack.Group
+	if !opts.noGroups || !opts.noMPIMs {
+		logf("dump private channel")
+		groups = dumpGroups(api, dir, rooms, usersMap, opts)
+	}
+
+	if opts.resumeFrom != "" {
+		logf("WARNING: channel %s to resume from was not found, no channel was dumped", opts.resumeFrom)
+	}
 
 	if len(groups) > 0 {
 		for _, group := range groups {
@@ -186,23 +1330,43 @@ func dumpRooms(api *slack.Client, dir string, rooms []string, usersMap UsersMap,
 		}
 	}
 
-	data, err := MarshalIndent(channels, "", "    ")
+	data, err := MarshalIndent(withRenames(channels), "", "    ")
 	check(err)
 	err = ioutil.WriteFile(path.Join(dir, "channels.json"), data, 0644)
 	check(err)
+
+	writeChannelSummary(dir)
+	writeRecentMessages(dir, opts)
+	writeReferences(dir, channels)
+	if opts.merged {
+		writeMergedTranscript(dir, usersMap, opts)
+	}
 }
 
-func dumpChannels(api *slack.Client, dir string, rooms []string, usersMap UsersMap, textOutput bool) []slack.Channel {
+func dumpChannels(api *slack.Client, dir string, rooms []string, usersMap UsersMap, opts *options) []slack.Channel {
+	if timedOut() {
+		return nil
+	}
 	channels, err := api.GetChannels(false)
 	check(err)
 
-	if len(rooms) > 0 {
+	// Private channels only ever list those the token's user is in.
+	if opts.memberOnly {
+		channels = FilterChannels(channels, func(channel slack.Channel) bool {
+			return channel.IsMember
+		})
+	}
+
+	if len(rooms) > 0 || len(opts.channelPrefixes) > 0 {
 		channels = FilterChannels(channels, func(channel slack.Channel) bool {
+			if hasPrefix(channel.Name, opts.channelPrefixes) {
+				return true
+			}
 			for _, room := range rooms {
 				if len(room) > 0 && room[0] == '%' {
 					re := regexp.MustCompile(room[1:])
 					if re.MatchString(channel.Name) { return true }
-				} else if room == channel.Name {
+				} else if room == channel.Name || roomID(room) == channel.ID || globMatch(room, channel.Name) {
 					return true
 				}
 			}
@@ -210,26 +1374,62 @@ func dumpChannels(api *slack.Client, dir string, rooms []string, usersMap UsersM
 		})
 	}
 
+	// Slack returns channels in no particular order. Going by name keeps
+	// runs comparable and gives --resume-from-channel a meaning.
+	sort.Sort(byChannelName(channels))
+	if opts.resumeFrom != "" {
+		names := make([]string, len(channels))
+		for i, channel := range channels {
+			names[i] = channel.Name
+		}
+		channels = channels[resumeIndex(names, opts):]
+	}
+	channels = channels[:capRooms(len(channels), opts)]
+	if opts.botToken && opts.joinChannels {
+		channels = joinChannels(api, channels)
+	}
+
 	if len(channels) == 0 {
 		var channels []slack.Channel
 		return channels
 	}
 
-	for _, channel := range channels {
-		fmt.Println("dump channel " + channel.Name)
-		dumpChannel(api, dir, channel.ID, channel.Name, "channel", usersMap, textOutput)
-	}
+	kept := make([]bool, len(channels))
+	forEach(len(channels), opts.concurrency, opts.delay, func(i int) {
+		logWith(logFields{"channel": channels[i].Name}, "dump channel %s (%d/%d)", channels[i].Name, i+1, len(channels))
+		kept[i] = dumpConversation(api, dir, channelMeta(channels[i]), usersMap, opts)
+	})
 
-	return channels
+	var dumped []slack.Channel
+	for i, channel := range channels {
+		if kept[i] {
+			dumped = append(dumped, channel)
+		}
+	}
+	return dumped
 }
 
-func dumpGroups(api *slack.Client, dir string, rooms []string, usersMap UsersMap, textOutput bool) []slack.Group {
+func dumpGroups(api *slack.Client, dir string, rooms []string, usersMap UsersMap, opts *options) []slack.Group {
+	if timedOut() {
+		return nil
+	}
 	groups, err := api.GetGroups(false)
 	check(err)
-	if len(rooms) > 0 {
+	if opts.noGroups || opts.noMPIMs {
 		groups = FilterGroups(groups, func(group slack.Group) bool {
+			if group.IsMpIM {
+				return !opts.noMPIMs
+			}
+			return !opts.noGroups
+		})
+	}
+	if len(rooms) > 0 || len(opts.channelPrefixes) > 0 {
+		groups = FilterGroups(groups, func(group slack.Group) bool {
+			if hasPrefix(group.Name, opts.channelPrefixes) {
+				return true
+			}
 			for _, room := range rooms {
-				if room == group.Name {
+				if room == group.Name || roomID(room) == group.ID || globMatch(room, group.Name) {
 					return true
 				}
 			}
@@ -237,203 +1437,657 @@ func dumpGroups(api *slack.Client, dir string, rooms []string, usersMap UsersMap
 		})
 	}
 
+	sort.Sort(byGroupName(groups))
+	if opts.resumeFrom != "" {
+		names := make([]string, len(groups))
+		for i, group := range groups {
+			names[i] = group.Name
+		}
+		groups = groups[resumeIndex(names, opts):]
+	}
+	groups = groups[:capRooms(len(groups), opts)]
+
 	if len(groups) == 0 {
 		var groups []slack.Group
 		return groups
 	}
 
-	for _, group := range groups {
-		fmt.Println("dump channel " + group.Name)
-		dumpChannel(api, dir, group.ID, group.Name, "group", usersMap, textOutput)
+	// The new names go in channels.json too, so that it names the files.
+	if opts.mpimNames {
+		for i := range groups {
+			if groups[i].IsMpIM {
+				groups[i].Name = mpimName(groups[i], usersMap)
+			}
+		}
+	}
+
+	kept := make([]bool, len(groups))
+	forEach(len(groups), opts.concurrency, opts.delay, func(i int) {
+		logWith(logFields{"channel": groups[i].Name}, "dump channel %s (%d/%d)", groups[i].Name, i+1, len(groups))
+		kept[i] = dumpConversation(api, dir, groupMeta(groups[i]), usersMap, opts)
+	})
+
+	var dumped []slack.Group
+	for i, group := range groups {
+		if kept[i] {
+			dumped = append(dumped, group)
+		}
 	}
+	return dumped
+}
+
+// archiveURLRE matches a Slack link to a conversation or to a message in
+// it, such as https://team.slack.com/archives/C0123 or .../C0123/p1234.
+var archiveURLRE = regexp.MustCompile(`^https?://[^/]+/archives/([A-Z0-9]+)([/?#]|$)`)
+
+// roomID returns the conversation ID an argument stands for: the one in a
+// Slack link pasted as is, or else the argument itself, which may be an ID.
+func roomID(room string) string {
+	if m := archiveURLRE.FindStringSubmatch(room); m != nil {
+		return m[1]
+	}
+	return room
+}
+
+// hasPrefix reports whether name starts with any of prefixes.
+func hasPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
 
-	return groups
+// isGlob reports whether room is a shell-style pattern such as
+// team-*-standup or proj-[abc] rather than a name. A %regexp is not one.
+func isGlob(room string) bool {
+	return !strings.HasPrefix(room, "%") && strings.ContainsAny(room, "*?[")
+}
+
+// globMatch reports whether room is a pattern that name matches. Patterns
+// are checked before the run starts, so a bad one does not match anything.
+func globMatch(room string, name string) bool {
+	if !isGlob(room) {
+		return false
+	}
+	matched, err := path.Match(room, name)
+	return err == nil && matched
+}
+
+// resumeIndex returns the index of the first room in names to dump when
+// resuming after opts.resumeFrom. Public channels are dumped before private
+// ones, so once the resume point is found it is cleared and the rooms that
+// follow are dumped in full.
+func resumeIndex(names []string, opts *options) int {
+	for i, name := range names {
+		if name == opts.resumeFrom {
+			opts.resumeFrom = ""
+			return i + 1
+		}
+	}
+	return len(names)
+}
+
+// capRooms returns how many of count rooms to dump under --max-channels.
+// Public channels are dumped before private ones and share the cap with
+// them, so the rooms taken are counted against it.
+func capRooms(count int, opts *options) int {
+	if opts.maxChannels <= 0 {
+		return count
+	}
+	if left := opts.maxChannels - opts.channelsTaken; count > left {
+		count = left
+	}
+	opts.channelsTaken += count
+	return count
+}
+
+// ChannelMeta describes the channel, group or DM whose messages are being
+// written, so that renderers can show where the messages came from.
+type ChannelMeta struct {
+	ID      string
+	Name    string
+	Type    string // "channel", "group" or "dm"
+	Shared  bool   // shared with other workspaces
+	Topic   string
+	Purpose string
+	Created time.Time
+	Members int
+}
+
+func channelMeta(channel slack.Channel) *ChannelMeta {
+	return &ChannelMeta{
+		ID:      channel.ID,
+		Name:    channel.Name,
+		Type:    "channel",
+		Shared:  channel.IsShared || channel.IsExtShared,
+		Topic:   channel.Topic.Value,
+		Purpose: channel.Purpose.Value,
+		Created: channel.Created.Time(),
+		Members: len(channel.Members),
+	}
+}
+
+func groupMeta(group slack.Group) *ChannelMeta {
+	return &ChannelMeta{
+		ID:      group.ID,
+		Name:    group.Name,
+		Type:    "group",
+		Shared:  group.IsShared || group.IsExtShared,
+		Topic:   group.Topic.Value,
+		Purpose: group.Purpose.Value,
+		Created: group.Created.Time(),
+		Members: len(group.Members),
+	}
+}
+
+func imMeta(im slack.IM, userName string) *ChannelMeta {
+	return &ChannelMeta{
+		ID:      im.ID,
+		Name:    userName,
+		Type:    "dm",
+		Created: im.Created.Time(),
+		Members: 2,
+	}
+}
+
+// dumpConversation is dumpChannel, with its errors handled as the error
+// policy says: by default the run stops at the first one, and with
+// --continue-on-error the conversation is left out, the error is recorded
+// as a warning and the run goes on with the next one.
+func dumpConversation(api *slack.Client, dir string, meta *ChannelMeta, usersMap UsersMap, opts *options) (kept bool) {
+	if timedOut() {
+		return false
+	}
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if err, ok := r.(error); ok && isTimeout(err) {
+			kept = false
+			return
+		}
+		stats.addError()
+		if !opts.continueOnError {
+			logf("ERROR: could not dump %s: %v", meta.Name, r)
+			if err, ok := r.(error); ok {
+				os.Exit(exitCode(err))
+			}
+			os.Exit(exitFailure)
+		}
+		addWarning("could not dump %s, it was left out: %v", meta.Name, r)
+		kept = false
+	}()
+	return dumpChannel(api, dir, meta, usersMap, opts)
 }
 
-func dumpChannel(api *slack.Client, dir, id, name, channelType string, usersMap UsersMap, textOutput bool) {
-	var messages []slack.Message
+// messageHook, when set, is called with every message of a conversation,
+// in order, before its files are written. There is no flag for it: it is
+// for builds that add their own processing, such as indexing, in a file
+// that sets it from an init function.
+var messageHook func(channelID string, msg slack.Message)
+
+// dumpChannel fetches and writes the history of one conversation. It
+// returns false when the conversation was left out for having fewer than
+// opts.minMessages messages.
+func dumpChannel(api *slack.Client, dir string, meta *ChannelMeta, usersMap UsersMap, opts *options) bool {
+	var get historyFunc
 	var channelPath string
-	if channelType == "group" {
+	if meta.Type == "group" {
 		channelPath = "private_channel"
-		messages = fetchGroupHistory(api, id)
-	} else if channelType == "dm" {
+		get = api.GetGroupHistory
+	} else if meta.Type == "dm" {
 		channelPath = "direct_message"
-		messages = fetchDirectMessageHistory(api, id)
+		get = api.GetIMHistory
 	} else {
 		channelPath = "channel"
-		messages = fetchChannelHistory(api, id)
+		get = api.GetChannelHistory
+	}
+	if meta.Shared {
+		get = conversationsHistory(api)
+	}
+	messages, truncated := fetchHistory(meta.Name, meta.ID, get, opts)
+
+	if truncated {
+		oldest := "the beginning"
+		if len(messages) > 0 {
+			oldest = formatTime(parseTimestamp(messages[len(messages)-1].Timestamp), "Jan 2 2006")
+		}
+		addWarning("history of %s may be truncated by the workspace plan's history limit: "+
+			"Slack had more messages but returned none older than %s", meta.Name, oldest)
+	}
+
+	if opts.replies {
+		messages = append(messages, fetchReplies(api, meta, messages, opts)...)
+	}
+	// Renamings are taken from the whole history fetched: who posted them
+	// has nothing to do with the messages asked for.
+	addChannelRenames(meta, messages)
+	messages = filterMessages(messages, meta, opts)
+
+	// The minimum goes by the messages that would be written.
+	if len(messages) < opts.minMessages {
+		logf("skip %s: only %d messages", meta.Name, len(messages))
+		return false
+	}
+
+	files := 0
+	for _, msg := range messages {
+		files += len(messageFiles(msg))
+	}
+	stats.addConversation(meta, messages, files)
+
+	if opts.bookmarks && meta.Type != "dm" {
+		writeBookmarks(dir, channelPath, meta, opts)
 	}
 
 	if len(messages) == 0 {
-		return
+		if meta.Type != "dm" {
+			addChannelSummary(meta, nil, usersMap, opts)
+		}
+		return true
 	}
 
-	sort.Sort(byTimestamp(messages))
+	if opts.newestFirst {
+		sort.Sort(sort.Reverse(byTimestamp(messages)))
+	} else {
+		sort.Sort(byTimestamp(messages))
+	}
 
-	writeMessagesFile(messages, dir, channelPath, name, usersMap, textOutput)
+	resolveExternalUsers(api, messages, usersMap, opts.teamID)
+	if meta.Type != "dm" {
+		addChannelSummary(meta, messages, usersMap, opts)
+	}
+	if opts.recentMessages > 0 {
+		addRecentMessages(meta, messages, opts)
+	}
+	addChannelReferences(meta, messages)
+
+	if messageHook != nil {
+		for _, msg := range messages {
+			messageHook(meta.ID, msg)
+		}
+	}
+
+	writeMessagesFile(messages, dir, channelPath, meta, usersMap, opts)
+	return true
 }
 
 var mentionRE = regexp.MustCompile("<@[0-9A-Z]+>")
 
-func sameDay(t1, t2 *time.Time) bool {
-	return t1.Year() == t2.Year() && t1.YearDay() == t2.YearDay()
+// subteamRE matches mentions of user groups, which carry the group's
+// handle unless it was renamed or the message is old.
+var subteamRE = regexp.MustCompile(`<!subteam\^([0-9A-Z]+)(?:\|([^<>]*))?>`)
+
+// unknownTime is shown for the time and the day of a message whose ts
+// cannot be read.
+const unknownTime = "unknown"
+
+// formatTime formats t with layout, or gives unknownTime when t is nil.
+func formatTime(t *time.Time, layout string) string {
+	if t == nil {
+		return unknownTime
+	}
+	return t.Format(layout)
 }
 
-func writeMessagesFile(messages []slack.Message, dir string, channelPath string, filename string, usersMap UsersMap,
-	                   textOutput bool) {
-	if len(messages) == 0 || dir == "" || channelPath == "" || filename == "" {
-		return
+// formatDay is the heading for the day t is on, or unknownTime when t is nil.
+func formatDay(t *time.Time, opts *options) string {
+	if t == nil {
+		return unknownTime
 	}
-	channelDir := path.Join(dir, channelPath)
-	err := os.MkdirAll(channelDir, 0755)
-	check(err)
+	return formatDate(*t, opts.dateFormat, opts.locale)
+}
 
-	var data []byte
+// newDay tells whether t, the time of a message, is on another day than
+// last, that of the message before it, and moves last on to it. Messages
+// whose time is unknown make a day of their own.
+func newDay(t *time.Time, last *string) bool {
+	day := formatTime(t, "2006-01-02")
+	if day == *last {
+		return false
+	}
+	*last = day
+	return true
+}
 
-	if textOutput {
-		sdata := ""
-		lastTimestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
-		for _, msg := range messages {
-			timestamp := parseTimestamp(msg.Timestamp)
-			if !sameDay(timestamp, &lastTimestamp) {
-				sdata += fmt.Sprintf("\n----------------   %s    ----------------\n",
-					                 timestamp.Format("Monday, Jan 2 2006"))
+// textHeader returns the block of channel information that opens a plain
+// text dump.
+func textHeader(meta *ChannelMeta, opts *options) string {
+	var header string
+	if meta.Type == "dm" {
+		header = fmt.Sprintf("Direct message with %s\n", meta.Name)
+	} else {
+		header = fmt.Sprintf("Channel: #%s\n", meta.Name)
+	}
+	if meta.Topic != "" {
+		header += fmt.Sprintf("Topic:   %s\n", meta.Topic)
+	}
+	if meta.Purpose != "" {
+		header += fmt.Sprintf("Purpose: %s\n", meta.Purpose)
+	}
+	if meta.Created.Unix() > 0 {
+		header += fmt.Sprintf("Created: %s\n", formatDate(meta.Created.Local(), opts.dateFormat, opts.locale))
+	}
+	if meta.Members > 0 {
+		header += fmt.Sprintf("Members: %d\n", meta.Members)
+	}
+	return header
+}
+
+// filterMessages leaves out of the history of a conversation the messages
+// that --user-filter, the period asked for, --only-my-messages and --no-bots
+// do not want. It runs before anything is made of the messages, so that the
+// message files and every file made from them hold the same messages.
+func filterMessages(messages []slack.Message, meta *ChannelMeta, opts *options) []slack.Message {
+	if opts.userFilterID != "" {
+		mention := "<@" + opts.userFilterID + ">"
+		messages = FilterMessages(messages, func(msg slack.Message) bool {
+			if msg.User == opts.userFilterID {
+				return true
 			}
-			lastTimestamp = *timestamp
-
-			userName, foundUser := usersMap[msg.User]
-			if !foundUser { userName = &UserInfo{ msg.User, msg.User} }
-			text := mentionRE.ReplaceAllStringFunc(msg.Text, func (t string) string {
-				userName, foundUser := usersMap[t[2:len(t)-1]]
-				if !foundUser { userName = &UserInfo{ msg.User, msg.User} }
-				if msg.SubType != "" {
-					return fmt.Sprintf("%s", userName.RealName)
-				} else {
-					return fmt.Sprintf("@%s", userName.Login)
+			for _, m := range mentionRE.FindAllString(msg.Text, -1) {
+				if m == mention {
+					return true
 				}
-			})
-			if msg.SubType == "" {
-				sdata += fmt.Sprintf("[%s] %s: %s\n", timestamp.Format("15:04:05"), userName.RealName, text)
-			} else {
-				sdata += fmt.Sprintf("[%s] %s\n", timestamp.Format("15:04:05"), text)
 			}
+			return false
+		})
+	}
+
+	// Slack's bounds are exclusive, and paging should keep to them; a
+	// message that slips through anyway is not written. Threads started in
+	// the period are kept whole, later replies included.
+	if opts.oldest != "" || opts.latest != "" {
+		count := len(messages)
+		messages = FilterMessages(messages, func(msg slack.Message) bool {
+			return keptInPeriod(msg, opts)
+		})
+		if dropped := count - len(messages); dropped > 0 {
+			logf("  %s: left out %d messages that Slack sent from outside the period asked for", meta.Name, dropped)
 		}
+	}
 
-		err = ioutil.WriteFile(path.Join(channelDir, filename + ".txt"), []byte(sdata), 0644)
-		check(err)
+	if opts.onlyMine {
+		messages = FilterMessages(messages, func(msg slack.Message) bool {
+			return msg.User == opts.selfID
+		})
 	}
 
+	if opts.noBots {
+		messages = FilterMessages(messages, func(msg slack.Message) bool {
+			return msg.BotID == "" && msg.SubType != "bot_message"
+		})
+	}
+	return messages
+}
 
-	data, err = MarshalIndent(messages, "", "    ")
-	check(err)
+func writeMessagesFile(messages []slack.Message, dir string, channelPath string, meta *ChannelMeta, usersMap UsersMap,
+	                   opts *options) {
+	if len(messages) == 0 || dir == "" || channelPath == "" || meta.Name == "" {
+		return
+	}
+	messages = sanitizeMessages(messages, meta)
+	if opts.merged {
+		addMergedMessages(meta, messages)
+	}
 
-	err = ioutil.WriteFile(path.Join(channelDir, filename + ".json"), data, 0644)
-	check(err)
-}
+	if opts.reactionsDetail {
+		completeReactions(messages, meta, opts)
+	}
+	if rendered(opts.formats) {
+		fetchCallRooms(messages, meta, opts)
+		checkRendering(messages, meta, usersMap, opts)
+	}
 
-const fetchSleep = time.Minute / 2
-const fetchesBetweenSleeps = 50
-var fetchInvocationCount = 0
+	for _, format := range opts.formats {
+		ctx := OutputContext{Dir: dir, ChannelPath: channelPath, Layout: opts.layout, UsersMap: usersMap, Opts: opts}
+		err := outputWriter(format).WriteChannel(ctx, *meta, messages)
+		check(err)
+	}
 
-func sleepBeforeFetchIfNeeded() {
-	fetchInvocationCount += 1
-	if fetchInvocationCount % fetchesBetweenSleeps == 0 {
-		fmt.Println("... sleeping for a bit to avoid '429 Too Many Requests' error from slack server ...")
-		time.Sleep(fetchSleep)
+	channelDir, filename := sideFiles(dir, channelPath, meta, opts)
+	if opts.events {
+		writeEvents(messages, channelDir, filename)
 	}
-}
 
-func fetchGroupHistory(api *slack.Client, ID string) []slack.Message {
-	sleepBeforeFetchIfNeeded()
+	if opts.membership {
+		writeMembership(messages, channelDir, filename)
+	}
 
-	historyParams := slack.NewHistoryParameters()
-	historyParams.Count = 1000
+	if opts.downloadFiles || opts.thumbnailsOnly {
+		downloadFiles(messages, meta, dir, opts)
+	}
+}
 
-	// Fetch History
-	history, err := api.GetGroupHistory(ID, historyParams)
+// sideFiles returns the folder, which it creates, and the base name of the
+// files kept next to a conversation's messages, such as its events file.
+func sideFiles(dir string, channelPath string, meta *ChannelMeta, opts *options) (string, string) {
+	name := sanitizeName(meta.Name)
+	channelDir := path.Join(dir, opts.layout.dir(channelPath, name, "json"))
+	err := os.MkdirAll(channelDir, 0755)
 	check(err)
-	messages := history.Messages
-	latest := messages[len(messages)-1].Timestamp
-	for {
-		if history.HasMore != true {
-			break
-		}
-
-		historyParams.Latest = latest
-		history, err = api.GetGroupHistory(ID, historyParams)
-		check(err)
-		length := len(history.Messages)
-		if length > 0 {
-			latest = history.Messages[length-1].Timestamp
-			messages = append(messages, history.Messages...)
-		}
+	return channelDir, opts.layout.file(channelPath, name, "")
+}
 
+// writeFileIfChanged writes data to name unless the file already holds
+// exactly that, so that dumping again into the same --dir leaves unchanged
+// files, and their modification times, alone.
+func writeFileIfChanged(name string, data []byte) error {
+	if old, err := ioutil.ReadFile(name); err == nil && sha256.Sum256(old) == sha256.Sum256(data) {
+		return nil
 	}
+	return ioutil.WriteFile(name, data, 0644)
+}
 
-	return messages
+// formatExtensions maps each output format to the extension of its files.
+var formatExtensions = map[string]string{
+	"json":    ".json",
+	"text":    ".txt",
+	"html":    ".html",
+	"md":      ".md",
+	"csv":     ".csv",
+	"discord": ".discord.json",
+	"mbox":    ".mbox",
 }
 
-func fetchChannelHistory(api *slack.Client, ID string) []slack.Message {
-	sleepBeforeFetchIfNeeded()
+// messageAuthor returns the name to show for the author of msg.
+func messageAuthor(msg slack.Message, usersMap UsersMap, opts *options) string {
+	userName, foundUser := usersMap.get(msg.User)
+	if !foundUser { userName = &UserInfo{Login: msg.User, RealName: msg.User} }
+	label := userName.Label(opts.nameField)
+	// Users of ours can post from another workspace they are in too.
+	if !userName.External && externalMessage(msg, usersMap, opts) {
+		label += " [external]"
+	}
+	return label
+}
 
-	historyParams := slack.NewHistoryParameters()
-	historyParams.Count = 1000
+// messageText returns the text of msg with user mentions replaced by names.
+// A message with no text but blocks gets the text of its blocks.
+func messageText(msg slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) string {
+	return labelledText(msg, meta, usersMap, opts, func(s string) string { return s })
+}
 
-	// Fetch History
-	history, err := api.GetChannelHistory(ID, historyParams)
-	check(err)
-	messages := history.Messages
-	latest := messages[len(messages)-1].Timestamp
-	for {
-		if history.HasMore != true {
-			break
+// messageHTML is messageText for the HTML output, which escapes the names
+// it puts in: unlike the text around them, Slack has not escaped them.
+func messageHTML(msg slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) string {
+	return labelledText(msg, meta, usersMap, opts, html.EscapeString)
+}
+
+// labelledText returns the text of msg, a message of meta, with the names
+// of users and user groups put in through label.
+func labelledText(msg slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options, label func(string) string) string {
+	if callSubtypes[msg.SubType] {
+		return callText(msg, meta, usersMap, opts, label)
+	}
+	if msg.SubType == "reminder_add" {
+		return reminderText(msg, usersMap, opts, label)
+	}
+	text := msg.Text
+	if text == "" {
+		text = blocksText(msg.Blocks)
+	}
+	text = subteamRE.ReplaceAllStringFunc(text, func(t string) string {
+		m := subteamRE.FindStringSubmatch(t)
+		if m[2] != "" {
+			return "@" + label(strings.TrimPrefix(m[2], "@"))
+		}
+		if handle, ok := opts.userGroups[m[1]]; ok {
+			return "@" + label(handle)
 		}
+		return "@" + m[1]
+	})
+	return mentionRE.ReplaceAllStringFunc(text, func (t string) string {
+		userName, foundUser := usersMap.get(t[2:len(t)-1])
+		if !foundUser { userName = &UserInfo{Login: msg.User, RealName: msg.User} }
+		if msg.SubType != "" {
+			return fmt.Sprintf("%s", label(userName.Label(opts.nameField)))
+		} else if opts.nameField == "display" {
+			return fmt.Sprintf("@%s", label(userName.Label(opts.nameField)))
+		} else {
+			return fmt.Sprintf("@%s", label(userName.Login))
+		}
+	})
+}
 
-		historyParams.Latest = latest
-		history, err = api.GetChannelHistory(ID, historyParams)
-		check(err)
-		length := len(history.Messages)
-		if length > 0 {
-			latest = history.Messages[length-1].Timestamp
-			messages = append(messages, history.Messages...)
+func renderText(messages []slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) []byte {
+	sdata := textHeader(meta, opts)
+	lastDay := ""
+	// Replies are indented under the first message of their thread, and
+	// left out of the day separators, which follow the channel's messages.
+	for _, threaded := range threadOrder(messages) {
+		msg := threaded.msg
+		timestamp := parseTimestamp(msg.Timestamp)
+		indent := ""
+		if threaded.reply {
+			indent = "    "
+		} else {
+			if newDay(timestamp, &lastDay) {
+				sdata += fmt.Sprintf("\n----------------   %s    ----------------\n", formatDay(timestamp, opts))
+			}
 		}
 
+		text := messageText(msg, meta, usersMap, opts)
+		if opts.emojiUnicode {
+			text = emojiUnicode(text)
+		}
+		if link := permalink(meta, msg.Timestamp, opts); opts.permalinks && link != "" {
+			text += " <" + link + ">"
+		}
+		if msg.SubType == "" || msg.SubType == "thread_broadcast" {
+			sdata += fmt.Sprintf("%s[%s] %s: %s\n", indent, formatTime(timestamp, opts.timeFormat), messageAuthor(msg, usersMap, opts), text)
+		} else {
+			sdata += fmt.Sprintf("%s[%s] %s\n", indent, formatTime(timestamp, opts.timeFormat), text)
+		}
+		if opts.reactionsDetail && len(msg.Reactions) > 0 {
+			sdata += indent + "    " + textReactions(msg, usersMap, opts) + "\n"
+		}
 	}
+	return []byte(sdata)
+}
 
-	return messages
+const fetchSleep = time.Minute / 2
+const fetchesBetweenSleeps = 50
+var fetchInvocationCount = 0
+var fetchMutex sync.Mutex
+
+// sleepBeforeFetchIfNeeded holds fetchMutex while it sleeps, so every
+// worker waits out the pause together.
+func sleepBeforeFetchIfNeeded() {
+	fetchMutex.Lock()
+	defer fetchMutex.Unlock()
+	fetchInvocationCount += 1
+	if fetchInvocationCount % fetchesBetweenSleeps == 0 {
+		logf("... sleeping for a bit to avoid '429 Too Many Requests' error from slack server ...")
+		sleepUntilTimeout(fetchSleep)
+	}
 }
 
-func fetchDirectMessageHistory(api *slack.Client, ID string) []slack.Message {
+// historyFunc fetches one page of a conversation's history.
+type historyFunc func(ID string, params slack.HistoryParameters) (*slack.History, error)
+
+// fetchHistory pages through a conversation's history, newest first, from
+// opts.latest back to opts.oldest. Since that is the order Slack hands it
+// out in, a --limit-messages run stops as soon as it has enough. It also
+// reports whether Slack claimed to have more messages but stopped handing
+// them over, which is how plan history limits show up.
+func fetchHistory(name string, ID string, get historyFunc, opts *options) (messages []slack.Message, truncated bool) {
 	sleepBeforeFetchIfNeeded()
 
 	historyParams := slack.NewHistoryParameters()
 	historyParams.Count = 1000
+	if opts.limitMessages > 0 && opts.limitMessages < historyParams.Count {
+		historyParams.Count = opts.limitMessages
+	}
+	if opts.oldest != "" {
+		historyParams.Oldest = opts.oldest
+	}
+	historyParams.Latest = opts.latest
+	progress := newHistoryProgress(name)
+	defer progress.done()
 
 	// Fetch History
-	history, err := api.GetIMHistory(ID, historyParams)
+	start := time.Now()
+	history, err := get(ID, historyParams)
 	check(err)
-	messages := history.Messages
-	if len(messages) == 0 {
-		return messages
-	}
-	latest := messages[len(messages)-1].Timestamp
+	messages = history.Messages
+	progress.page(len(history.Messages), history.HasMore, time.Since(start))
 	for {
 		if history.HasMore != true {
 			break
 		}
+		if opts.limitMessages > 0 && len(messages) >= opts.limitMessages {
+			break
+		}
+		if timedOut() {
+			addWarning("history of %s was cut short by the run's timeout", name)
+			break
+		}
 
-		historyParams.Latest = latest
-		history, err = api.GetIMHistory(ID, historyParams)
-		check(err)
 		length := len(history.Messages)
-		if length > 0 {
-			latest = history.Messages[length-1].Timestamp
-			messages = append(messages, history.Messages...)
+		if length == 0 {
+			return messages, true
 		}
 
+		historyParams.Latest = history.Messages[length-1].Timestamp
+		start = time.Now()
+		history, err = get(ID, historyParams)
+		check(err)
+		messages = append(messages, history.Messages...)
+		progress.page(len(history.Messages), history.HasMore, time.Since(start))
 	}
 
-	return messages
+	if opts.limitMessages > 0 && len(messages) > opts.limitMessages {
+		messages = messages[:opts.limitMessages]
+	}
+	return messages, false
+}
+
+// exportWarnings collects the problems found during the run that leave the
+// export incomplete. They are printed as they happen and saved with the
+// export by writeWarnings.
+var exportWarnings []string
+var exportWarningsMutex sync.Mutex
+
+func addWarning(format string, a ...interface{}) {
+	warning := fmt.Sprintf(format, a...)
+	logf("WARNING: %s", warning)
+	exportWarningsMutex.Lock()
+	exportWarnings = append(exportWarnings, warning)
+	exportWarningsMutex.Unlock()
+}
+
+func writeWarnings(dir string) {
+	if len(exportWarnings) == 0 {
+		return
+	}
+	data, err := MarshalIndent(exportWarnings, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "warnings.json"), data, 0644)
+	check(err)
 }
 
 func parseTimestamp(timestamp string) *time.Time {
@@ -452,11 +2106,43 @@ func parseTimestamp(timestamp string) *time.Time {
 	}
 
 	i, err := strconv.ParseInt(ts, 10, 64)
-	check(err)
+	if err != nil {
+		return nil
+	}
 	tm := time.Unix(i, 0).Local()
 	return &tm
 }
 
+// parsePreciseTimestamp is like parseTimestamp but keeps the microseconds.
+// It also hands back the ts string itself: that is what identifies a
+// message, and unlike the truncated time it is unique within a channel, so
+// it is what anything named after a message should use.
+func parsePreciseTimestamp(timestamp string) (*time.Time, string) {
+	if utf8.RuneCountInString(timestamp) <= 0 {
+		return nil, timestamp
+	}
+
+	secs, micros := timestamp, "0"
+	if strings.Contains(timestamp, ".") {
+		e := strings.Split(timestamp, ".")
+		if len(e) != 2 {
+			return nil, timestamp
+		}
+		secs, micros = e[0], (e[1] + "000000")[:6]
+	}
+
+	i, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return nil, timestamp
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, timestamp
+	}
+	tm := time.Unix(i, us*int64(time.Microsecond)).Local()
+	return &tm, timestamp
+}
+
 // FilterGroups returns a new slice holding only
 // the elements of s that satisfy f()
 func FilterGroups(s []slack.Group, fn func(slack.Group) bool) []slack.Group {
@@ -492,3 +2178,15 @@ func FilterUsers(s []slack.User, fn func(slack.User) bool) []slack.User {
 	}
 	return p
 }
+
+// FilterMessages returns a new slice holding only
+// the elements of s that satisfy f()
+func FilterMessages(s []slack.Message, fn func(slack.Message) bool) []slack.Message {
+	var p []slack.Message // == nil
+	for _, v := range s {
+		if fn(v) {
+			p = append(p, v)
+		}
+	}
+	return p
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestMarshalIndentEscaping(t *testing.T) {
+	type message struct {
+		Text string `json:"text"`
+	}
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"plain", message{"hello"}, `{
+    "text": "hello"
+}`},
+		{"less than", message{"a < b"}, `{
+    "text": "a < b"
+}`},
+		{"greater than", message{"a > b"}, `{
+    "text": "a > b"
+}`},
+		{"ampersand", message{"a & b"}, `{
+    "text": "a & b"
+}`},
+		{"slash", message{"either/or"}, `{
+    "text": "either\/or"
+}`},
+		{"url", message{"<https://example.com/a/b?c=1&d=2|example>"}, `{
+    "text": "<https:\/\/example.com\/a\/b?c=1&d=2|example>"
+}`},
+		{"quotes and backslashes", message{`say "hi" \ bye`}, `{
+    "text": "say \"hi\" \\ bye"
+}`},
+		{"array", []message{{"x/y"}, {"<&>"}}, `[
+    {
+        "text": "x\/y"
+    },
+    {
+        "text": "<&>"
+    }
+]`},
+	}
+
+	for _, test := range tests {
+		got, err := MarshalIndent(test.in, "", "    ")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMarshalIndentPlain(t *testing.T) {
+	plainJSON = true
+	defer func() { plainJSON = false }()
+
+	got, err := MarshalIndent(map[string]string{"text": "<https://example.com/a|a & b>"}, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+    "text": "\u003chttps://example.com/a|a \u0026 b\u003e"
+}`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInPeriod(t *testing.T) {
+	opts := &options{oldest: "1514764800", latest: "1514851200"}
+	tests := []struct {
+		ts   string
+		want bool
+	}{
+		{"1514764799.999999", false},
+		{"1514764800", false},
+		{"1514764800.000001", true},
+		{"1514800000.123456", true},
+		{"1514851199.999999", true},
+		{"1514851200.000000", false},
+		{"1514851200.000100", false},
+	}
+	for _, test := range tests {
+		if got := inPeriod(test.ts, opts); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.ts, got, test.want)
+		}
+	}
+
+	// --since-message-ts with --inclusive takes in the message at its ts.
+	opts = &options{oldest: tsBefore("1514764800.000200")}
+	if !inPeriod("1514764800.000200", opts) || inPeriod("1514764800.000199", opts) {
+		t.Errorf("inclusive bound at 1514764800.000200 is off")
+	}
+}
+
+func TestKeptInPeriod(t *testing.T) {
+	opts := &options{oldest: "1514764800", latest: "1514851200"}
+	message := func(ts, threadTS string) slack.Message {
+		return slack.Message{Msg: slack.Msg{Timestamp: ts, ThreadTimestamp: threadTS}}
+	}
+	tests := []struct {
+		name string
+		msg  slack.Message
+		want bool
+	}{
+		{"message in the period", message("1514800000.000100", ""), true},
+		{"message after the period", message("1514900000.000100", ""), false},
+		{"parent in the period", message("1514800000.000100", "1514800000.000100"), true},
+		{"reply after the period to a parent in it", message("1514900000.000200", "1514800000.000100"), true},
+		{"reply in the period to a parent before it", message("1514800000.000200", "1514700000.000100"), true},
+		{"reply after the period to a parent after it", message("1514900000.000200", "1514890000.000100"), false},
+		{"reply before the period to a parent before it", message("1514700000.000200", "1514700000.000100"), false},
+	}
+	for _, test := range tests {
+		if got := keptInPeriod(test.msg, opts); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProjectMessages(t *testing.T) {
+	messages := []slack.Message{
+		{Msg: slack.Msg{Timestamp: "1514764800.000100", User: "U1", Text: "hello", Type: "message"}},
+		{Msg: slack.Msg{Timestamp: "1514764800.000200", SubType: "channel_join", Type: "message"}},
+	}
+	got, err := projectMessages(messages, []string{"ts", "user", "text", "subtype", "usr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalIndent(got, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+    {
+        "text": "hello",
+        "ts": "1514764800.000100",
+        "user": "U1"
+    },
+    {
+        "subtype": "channel_join",
+        "ts": "1514764800.000200"
+    }
+]`
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+	if !fieldsFound["ts"] || fieldsFound["usr"] || fieldsFound["type"] {
+		t.Errorf("fields found: %v", fieldsFound)
+	}
+}
+
+func TestReminderAddRE(t *testing.T) {
+	tests := []struct {
+		text string
+		what string
+		when string
+	}{
+		{"set up a reminder “standup” in this channel at 9AM every weekday, Eastern Standard Time.",
+			"standup", "9AM every weekday, Eastern Standard Time"},
+		{"set up a reminder “send the &lt;report&gt;” for <@U0123ABCD> on Friday at 5PM.",
+			"send the &lt;report&gt;", "Friday at 5PM"},
+		{"set up a reminder “coffee” in this channel in 10 minutes", "coffee", "10 minutes"},
+		{"set up a reminder", "", ""},
+		{"hello", "", ""},
+	}
+	for _, test := range tests {
+		m := reminderAddRE.FindStringSubmatch(test.text)
+		if test.what == "" {
+			if m != nil {
+				t.Errorf("%q: matched %q, want no match", test.text, m)
+			}
+			continue
+		}
+		if m == nil || m[1] != test.what || m[2] != test.when {
+			t.Errorf("%q: got %q, want %q and %q", test.text, m, test.what, test.when)
+		}
+	}
+}
+
+func TestUnreadableTimestamp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slack-dump-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	messages := []slack.Message{
+		{Msg: slack.Msg{Timestamp: "1514764800.000100", User: "U1", Text: "readable", Type: "message"}},
+		{Msg: slack.Msg{Timestamp: "not-a-ts", User: "U1", Text: "unreadable", Type: "message"}},
+		{Msg: slack.Msg{Timestamp: "15147x.000300", User: "U1", SubType: "channel_join", Type: "message"}},
+	}
+	meta := &ChannelMeta{ID: "C1", Name: "general", Type: "channel"}
+	opts := &options{
+		formats:    []string{"json", "text", "html", "md", "csv", "discord", "mbox"},
+		layout:     layouts["by-date"],
+		timeFormat: "15:04",
+		dateFormat: "Jan 2 2006",
+	}
+	ctx := OutputContext{Dir: dir, ChannelPath: "channel", Layout: opts.layout, UsersMap: UsersMap{}, Opts: opts}
+	for _, format := range opts.formats {
+		if err := outputWriter(format).WriteChannel(ctx, *meta, messages); err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join(dir, "channel", "general", "unknown"+formatExtensions[format]))
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if !strings.Contains(string(data), "unreadable") {
+			t.Errorf("%s: the message is missing from\n%s", format, data)
+		}
+		if want := unknownTime; format == "mbox" {
+			if want = "Date: Thu, 01 Jan 1970"; !strings.Contains(string(data), want) {
+				t.Errorf("%s: no %q in\n%s", format, want, data)
+			}
+		} else if format != "json" && !strings.Contains(string(data), want) {
+			t.Errorf("%s: no %q in\n%s", format, want, data)
+		}
+	}
+
+	writeMembership(messages, dir, "general")
+	data, err := ioutil.ReadFile(path.Join(dir, "general.membership.json"))
+	if err != nil || !strings.Contains(string(data), `"time": "unknown"`) {
+		t.Errorf("membership: %v\n%s", err, data)
+	}
+
+	defer func() { mergedMessages = nil }()
+	addMergedMessages(meta, messages)
+	writeMergedTranscript(dir, UsersMap{}, opts)
+	data, err = ioutil.ReadFile(path.Join(dir, "merged.txt"))
+	if err != nil || !strings.Contains(string(data), "[unknown] #general") {
+		t.Errorf("merged: %v\n%s", err, data)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// The mbox format writes each message as an email, for the e-discovery
+// tools that load mailboxes. The conversation is the subject, and replies
+// point at the first message of their thread with In-Reply-To, so that
+// threads show as reply chains.
+
+// renderMbox renders messages as an mbox file, quoted the mboxrd way: body
+// lines that start with From, after any number of >, get one > more.
+func renderMbox(messages []slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) []byte {
+	domain := "slack.invalid"
+	if u, err := url.Parse(opts.teamURL); err == nil && u.Host != "" {
+		domain = u.Host
+	}
+	messageID := func(ts string) string {
+		return "<" + ts + "." + meta.ID + "@" + domain + ">"
+	}
+	subject := mime.QEncoding.Encode("utf-8", channelTitle(meta))
+
+	var b bytes.Buffer
+	for _, msg := range messages {
+		// A mail needs a date, so a message whose ts cannot be read is
+		// dated at the start of the Unix epoch rather than left out.
+		timestamp := parseTimestamp(msg.Timestamp)
+		if timestamp == nil {
+			epoch := time.Unix(0, 0).UTC()
+			timestamp = &epoch
+		}
+		login := msg.User
+		if user, ok := usersMap.get(msg.User); ok && user.Login != "" {
+			login = user.Login
+		}
+		if login == "" {
+			login = "unknown"
+		}
+		address := login + "@" + domain
+
+		fmt.Fprintf(&b, "From %s %s\n", address, timestamp.UTC().Format("Mon Jan _2 15:04:05 2006"))
+		fmt.Fprintf(&b, "From: %s <%s>\n", mime.QEncoding.Encode("utf-8", messageAuthor(msg, usersMap, opts)), address)
+		fmt.Fprintf(&b, "Date: %s\n", timestamp.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+		if isReply(msg) {
+			fmt.Fprintf(&b, "Subject: Re: %s\n", subject)
+			fmt.Fprintf(&b, "In-Reply-To: %s\n", messageID(msg.ThreadTimestamp))
+			fmt.Fprintf(&b, "References: %s\n", messageID(msg.ThreadTimestamp))
+		} else {
+			fmt.Fprintf(&b, "Subject: %s\n", subject)
+		}
+		fmt.Fprintf(&b, "Message-ID: %s\n", messageID(msg.Timestamp))
+		b.WriteString("MIME-Version: 1.0\n")
+		b.WriteString("Content-Type: text/plain; charset=utf-8\n")
+		b.WriteString("Content-Transfer-Encoding: 8bit\n\n")
+
+		text := slackEntities.Replace(messageText(msg, meta, usersMap, opts))
+		if opts.emojiUnicode {
+			text = emojiUnicode(text)
+		}
+		for _, line := range strings.Split(text, "\n") {
+			if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+				line = ">" + line
+			}
+			b.WriteString(line + "\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
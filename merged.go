@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// mergedMessage is a message of the merged transcript, with the
+// conversation it was posted in.
+type mergedMessage struct {
+	meta *ChannelMeta
+	msg  slack.Message
+}
+
+var mergedMessages []mergedMessage
+var mergedMessagesMutex sync.Mutex
+
+// addMergedMessages adds the messages of a conversation, as they are
+// written to its files, to the merged transcript.
+func addMergedMessages(meta *ChannelMeta, messages []slack.Message) {
+	mergedMessagesMutex.Lock()
+	defer mergedMessagesMutex.Unlock()
+	for _, msg := range messages {
+		mergedMessages = append(mergedMessages, mergedMessage{meta, msg})
+	}
+}
+
+// writeMergedTranscript saves merged.txt, the messages of every
+// conversation dumped in one timeline, oldest first, each labelled with its
+// conversation. With the html format, merged.html is written too.
+func writeMergedTranscript(dir string, usersMap UsersMap, opts *options) {
+	if len(mergedMessages) == 0 {
+		return
+	}
+	sort.SliceStable(mergedMessages, func(i, j int) bool {
+		return mergedMessages[i].msg.Timestamp < mergedMessages[j].msg.Timestamp
+	})
+
+	var text, page bytes.Buffer
+	fmt.Fprintf(&page, htmlHead, "Merged transcript")
+	fmt.Fprintf(&page, "<h1>Merged transcript</h1>\n")
+	lastDay := ""
+	for _, merged := range mergedMessages {
+		msg := merged.msg
+		timestamp, ts := parsePreciseTimestamp(msg.Timestamp)
+		if newDay(timestamp, &lastDay) {
+			day := formatDay(timestamp, opts)
+			fmt.Fprintf(&text, "\n----------------   %s    ----------------\n", day)
+			fmt.Fprintf(&page, "<h2>%s</h2>\n", html.EscapeString(day))
+		}
+
+		when := formatTime(timestamp, opts.timeFormat)
+		channel := channelTitle(merged.meta)
+		body := messageText(msg, merged.meta, usersMap, opts)
+		if opts.emojiUnicode {
+			body = emojiUnicode(body)
+		}
+		author := ""
+		if msg.SubType == "" {
+			author = messageAuthor(msg, usersMap, opts)
+			fmt.Fprintf(&text, "[%s] %s %s: %s\n", when, channel, author, body)
+		} else {
+			fmt.Fprintf(&text, "[%s] %s %s\n", when, channel, body)
+		}
+		class := "message"
+		if msg.SubType != "" {
+			class += " subtype"
+		}
+		fmt.Fprintf(&page, "<div class=\"%s\" id=\"ts-%s\"><span class=\"time\">%s</span> <span class=\"channel\">%s</span> <span class=\"author\">%s</span><div class=\"text\">%s</div></div>\n",
+			class, ts, timeLink(when, permalink(merged.meta, ts, opts)), html.EscapeString(channel), html.EscapeString(author),
+			convertMrkdwn(messageHTML(msg, merged.meta, usersMap, opts), htmlTarget))
+	}
+	page.WriteString("</body>\n</html>\n")
+
+	err := ioutil.WriteFile(path.Join(dir, "merged.txt"), withNewlines(text.Bytes(), opts), 0644)
+	check(err)
+	for _, format := range opts.formats {
+		if format == "html" {
+			err = ioutil.WriteFile(path.Join(dir, "merged.html"), page.Bytes(), 0644)
+			check(err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// identity is one person across workspaces, as listed in
+// users-merged.json: the accounts of the users.json files given that share
+// an email address.
+type identity struct {
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	Accounts []account `json:"accounts"`
+}
+
+// account is a person's user in one workspace.
+type account struct {
+	TeamID string `json:"team_id"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	File   string `json:"file"`
+}
+
+// mergeUsers links the users of the users.json files of several
+// workspaces' exports by email address, and saves who is who to
+// users-merged.json, or the file --output names.
+func mergeUsers(c *cli.Context) error {
+	if c.NArg() < 2 {
+		fmt.Println("ERROR: the merge-users command needs the users.json files of at least two exports...")
+		fmt.Println("")
+		cli.ShowCommandHelp(c, "merge-users")
+		os.Exit(exitUsage)
+	}
+
+	byEmail := make(map[string]*identity)
+	skipped := 0
+	for _, name := range c.Args().Slice() {
+		users, err := readUsersFile(name)
+		check(err)
+		for _, user := range users {
+			email := strings.ToLower(strings.TrimSpace(user.Profile.Email))
+			if email == "" || user.IsBot {
+				skipped++
+				continue
+			}
+			person := byEmail[email]
+			if person == nil {
+				person = &identity{Email: email, Name: user.RealName}
+				byEmail[email] = person
+			}
+			person.Accounts = append(person.Accounts, account{user.TeamID, user.ID, user.Name, name})
+		}
+	}
+
+	identities := make([]identity, 0, len(byEmail))
+	linked := 0
+	for _, person := range byEmail {
+		identities = append(identities, *person)
+		if len(person.Accounts) > 1 {
+			linked++
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].Email < identities[j].Email
+	})
+
+	data, err := MarshalIndent(identities, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(c.String("output"), data, 0644)
+	check(err)
+	logf("%d people, %d of them in more than one workspace, written to %s", len(identities), linked, c.String("output"))
+	if skipped > 0 {
+		logf("%d bots and users without an email address were left out", skipped)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mrkdwnTarget says how each piece of Slack's mrkdwn formatting is written
+// in an output format. Every function gets text exactly as Slack sent it,
+// with &, < and > still escaped as HTML entities.
+type mrkdwnTarget struct {
+	text       func(s string) string
+	codeBlock  func(code string) string
+	inlineCode func(code string) string
+	bold       func(s string) string
+	italic     func(s string) string
+	strike     func(s string) string
+	quote      func(lines []string) string
+	link       func(url, label string) string
+	lineBreak  string
+}
+
+var slackEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+var htmlTarget = &mrkdwnTarget{
+	text: func(s string) string { return s },
+	codeBlock: func(code string) string {
+		return "<pre>" + strings.Trim(code, "\n") + "</pre>"
+	},
+	inlineCode: func(code string) string { return "<code>" + code + "</code>" },
+	bold:       func(s string) string { return "<strong>" + s + "</strong>" },
+	italic:     func(s string) string { return "<em>" + s + "</em>" },
+	strike:     func(s string) string { return "<del>" + s + "</del>" },
+	quote: func(lines []string) string {
+		return "<blockquote>" + strings.Join(lines, "<br>\n") + "</blockquote>"
+	},
+	link: func(url, label string) string {
+		return `<a href="` + strings.Replace(url, `"`, "&quot;", -1) + `">` + label + "</a>"
+	},
+	lineBreak: "<br>\n",
+}
+
+var markdownTarget = &mrkdwnTarget{
+	text: slackEntities.Replace,
+	codeBlock: func(code string) string {
+		return "\n```\n" + strings.Trim(slackEntities.Replace(code), "\n") + "\n```\n"
+	},
+	inlineCode: func(code string) string { return "`" + slackEntities.Replace(code) + "`" },
+	bold:       func(s string) string { return "**" + s + "**" },
+	italic:     func(s string) string { return "_" + s + "_" },
+	strike:     func(s string) string { return "~~" + s + "~~" },
+	quote: func(lines []string) string {
+		return "> " + strings.Join(lines, "\n> ")
+	},
+	link: func(url, label string) string {
+		return "[" + label + "](" + slackEntities.Replace(url) + ")"
+	},
+	lineBreak: "\n",
+}
+
+// convertMrkdwn rewrites the formatting of a Slack message text for target.
+// Code blocks and inline code are copied verbatim; everything else may use
+// bold, italic, strikethrough, block quotes and links.
+func convertMrkdwn(text string, target *mrkdwnTarget) string {
+	var out strings.Builder
+	for i, part := range splitFenced(text, "```") {
+		if i%2 == 1 {
+			out.WriteString(target.codeBlock(part))
+		} else {
+			out.WriteString(convertLines(part, target))
+		}
+	}
+	return out.String()
+}
+
+// splitFenced splits s on fence, so that the odd elements of the result are
+// fenced. An unclosed fence is kept as text.
+func splitFenced(s, fence string) []string {
+	parts := strings.Split(s, fence)
+	if len(parts)%2 == 0 {
+		last := len(parts) - 1
+		parts[last-1] += fence + parts[last]
+		parts = parts[:last]
+	}
+	return parts
+}
+
+func convertLines(s string, target *mrkdwnTarget) string {
+	var out []string
+	var quoted []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(line, "&gt;") {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "&gt;"), " ")
+			quoted = append(quoted, convertInline(line, target))
+			continue
+		}
+		if len(quoted) > 0 {
+			out = append(out, target.quote(quoted))
+			quoted = nil
+		}
+		out = append(out, convertInline(line, target))
+	}
+	if len(quoted) > 0 {
+		out = append(out, target.quote(quoted))
+	}
+	return strings.Join(out, target.lineBreak)
+}
+
+func convertInline(s string, target *mrkdwnTarget) string {
+	var out strings.Builder
+	for i, part := range splitFenced(s, "`") {
+		if i%2 == 1 && part == "" {
+			out.WriteString(target.text("``"))
+		} else if i%2 == 1 {
+			out.WriteString(target.inlineCode(part))
+		} else {
+			out.WriteString(convertLinks(part, target))
+		}
+	}
+	return out.String()
+}
+
+var linkRE = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+
+// convertLinks turns <url|label> links into target links and the remaining
+// <...> references (users, channels, special mentions) into their labels.
+func convertLinks(s string, target *mrkdwnTarget) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range linkRE.FindAllStringSubmatchIndex(s, -1) {
+		out.WriteString(convertEmphasis(s[last:m[0]], target))
+		ref := s[m[2]:m[3]]
+		label := ""
+		if m[4] >= 0 {
+			label = s[m[4]:m[5]]
+		}
+
+		switch {
+		case strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "mailto:"):
+			if label == "" {
+				label = ref
+			}
+			out.WriteString(target.link(ref, target.text(label)))
+		case label != "" && (ref[0] == '@' || ref[0] == '#'):
+			out.WriteString(target.text(ref[:1] + strings.TrimLeft(label, "@#")))
+		case label != "":
+			out.WriteString(target.text(label))
+		case ref[0] == '!':
+			out.WriteString(target.text("@" + ref[1:]))
+		default:
+			out.WriteString(target.text(ref))
+		}
+		last = m[1]
+	}
+	out.WriteString(convertEmphasis(s[last:], target))
+	return out.String()
+}
+
+// convertEmphasis handles *bold*, _italic_ and ~strike~. As in Slack, a
+// marker only counts at the edge of a word, so snake_case stays as it is.
+func convertEmphasis(s string, target *mrkdwnTarget) string {
+	var out strings.Builder
+	plain := 0
+	for i := 0; i < len(s); i++ {
+		var wrap func(string) string
+		switch s[i] {
+		case '*':
+			wrap = target.bold
+		case '_':
+			wrap = target.italic
+		case '~':
+			wrap = target.strike
+		}
+		if wrap == nil || (i > 0 && isWordByte(s[i-1])) || i+1 >= len(s) || s[i+1] == ' ' || s[i+1] == s[i] {
+			continue
+		}
+		end := closingMarker(s, i+1, s[i])
+		if end < 0 {
+			continue
+		}
+
+		out.WriteString(target.text(s[plain:i]))
+		out.WriteString(wrap(convertEmphasis(s[i+1:end], target)))
+		i = end
+		plain = end + 1
+	}
+	out.WriteString(target.text(s[plain:]))
+	return out.String()
+}
+
+func closingMarker(s string, from int, marker byte) int {
+	for j := from; j < len(s); j++ {
+		if s[j] == '\n' {
+			return -1
+		}
+		if s[j] == marker && s[j-1] != ' ' && (j+1 == len(s) || !isWordByte(s[j+1])) {
+			return j
+		}
+	}
+	return -1
+}
+
+func isWordByte(b byte) bool {
+	return b >= 0x80 || b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestConvertMrkdwn(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		markdown string
+		html     string
+	}{
+		{"plain", "hello", "hello", "hello"},
+		{"emphasis", "*bold* _italic_ ~strike~",
+			"**bold** _italic_ ~~strike~~",
+			"<strong>bold</strong> <em>italic</em> <del>strike</del>"},
+		{"snake case", "snake_case_name", "snake_case_name", "snake_case_name"},
+		{"entities", "a &lt; b &amp;&amp; c &gt; d",
+			"a < b && c > d",
+			"a &lt; b &amp;&amp; c &gt; d"},
+		{"escaped markup", "&lt;script&gt;alert(1)&lt;/script&gt;",
+			"<script>alert(1)</script>",
+			"&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"link", "see <https://example.com/a?b=1&amp;c=2|the docs>",
+			"see [the docs](https://example.com/a?b=1&c=2)",
+			`see <a href="https://example.com/a?b=1&amp;c=2">the docs</a>`},
+		{"bare link", "<https://example.com>",
+			"[https://example.com](https://example.com)",
+			`<a href="https://example.com">https://example.com</a>`},
+		{"quote in link", `<https://example.com/?q="x"|x>`,
+			`[x](https://example.com/?q="x")`,
+			`<a href="https://example.com/?q=&quot;x&quot;">x</a>`},
+		{"mentions", "<@U0123|alice> <#C0123|general> <!here>",
+			"@alice #general @here",
+			"@alice #general @here"},
+		{"inline code", "run `a &lt; b` now",
+			"run `a < b` now",
+			"run <code>a &lt; b</code> now"},
+		{"code block", "```\nif a &gt; b {\n```",
+			"\n```\nif a > b {\n```\n",
+			"<pre>if a &gt; b {</pre>"},
+		{"no emphasis in code", "`*not bold*`", "`*not bold*`", "<code>*not bold*</code>"},
+		{"quote", "&gt; quoted &amp; more\nnot quoted",
+			"> quoted & more\nnot quoted",
+			"<blockquote>quoted &amp; more</blockquote><br>\nnot quoted"},
+	}
+
+	for _, test := range tests {
+		if got := convertMrkdwn(test.in, markdownTarget); got != test.markdown {
+			t.Errorf("%s: markdown got %q, want %q", test.name, got, test.markdown)
+		}
+		if got := convertMrkdwn(test.in, htmlTarget); got != test.html {
+			t.Errorf("%s: html got %q, want %q", test.name, got, test.html)
+		}
+	}
+}
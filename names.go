@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nlopes/slack"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// unsafeNameChars are replaced in file names: the path separators, and the
+// characters Windows does not allow in file names.
+var unsafeNameChars = strings.NewReplacer("/", "_", "\\", "_", "\x00", "_",
+	"<", "_", ">", "_", ":", "_", "\"", "_", "|", "_", "?", "_", "*", "_")
+
+// windowsDeviceNames are the names Windows keeps for devices, and will not
+// create a file under, whatever its case or extension.
+var windowsDeviceNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeName turns a channel or user name into a file name. Names are
+// put in Unicode normal form C so that an archive made on macOS, which
+// decomposes file names, unpacks to the same names everywhere else. For the
+// same reason a name Windows keeps for a device, such as con or aux, gets an
+// underscore after it on every system: con.json becomes con_.json.
+func sanitizeName(name string) string {
+	name = unsafeNameChars.Replace(norm.NFC.String(name))
+	base := name
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	if windowsDeviceNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = base + "_" + name[len(base):]
+	}
+	return name
+}
+
+// mpimName returns a name for a multi-party DM made of its members' user
+// names in order, such as alice-bob-carol, in place of Slack's mpdm-...
+// name. When a member is unknown, Slack's name is kept.
+func mpimName(group slack.Group, usersMap UsersMap) string {
+	var logins []string
+	for _, ID := range group.Members {
+		user, ok := usersMap.get(ID)
+		if !ok || user.Unknown || user.Login == "" {
+			return group.Name
+		}
+		logins = append(logins, user.Login)
+	}
+	if len(logins) == 0 {
+		return group.Name
+	}
+	sort.Strings(logins)
+	return strings.Join(logins, "-")
+}
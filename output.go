@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// OutputWriter writes the messages of a conversation in one format. The
+// messages are those a message file would get, in the order it would have
+// them; ctx tells where the export is and how the run was asked to write it.
+type OutputWriter interface {
+	WriteChannel(ctx OutputContext, meta ChannelMeta, msgs []slack.Message) error
+}
+
+// OutputContext is what an OutputWriter gets besides the conversation: the
+// export it writes into, the kind of the conversation's folder (channel,
+// private_channel or direct_message), where --layout puts files, the users
+// by ID and the run's options.
+type OutputContext struct {
+	Dir         string
+	ChannelPath string
+	Layout      *layout
+	UsersMap    UsersMap
+	Opts        *options
+}
+
+// Folder creates and returns the folder that the files of format for meta
+// go in, and their base name, to which the writer adds its extension. With
+// a layout that splits conversations by day, day is the date of the
+// messages of the file.
+func (ctx OutputContext) Folder(meta ChannelMeta, format string, day string) (string, string, error) {
+	name := sanitizeName(meta.Name)
+	dir := path.Join(ctx.Dir, ctx.Layout.dir(ctx.ChannelPath, name, format))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	return dir, ctx.Layout.file(ctx.ChannelPath, name, day), nil
+}
+
+// outputWriters are the formats added with RegisterOutputWriter, by name.
+var outputWriters = map[string]OutputWriter{}
+
+// RegisterOutputWriter adds a format that --formats can name, written by w.
+// Like messageHook, it is for builds that add a format of their own in a
+// file that calls it from an init function.
+func RegisterOutputWriter(format string, w OutputWriter) {
+	outputWriters[format] = w
+}
+
+// knownFormat reports whether --formats can name format.
+func knownFormat(format string) bool {
+	_, builtIn := formatExtensions[format]
+	_, registered := outputWriters[format]
+	return builtIn || registered
+}
+
+// outputWriter returns the writer of format: a registered one, or else the
+// built-in formatWriter.
+func outputWriter(format string) OutputWriter {
+	if w, ok := outputWriters[format]; ok {
+		return w
+	}
+	return &formatWriter{format}
+}
+
+// formatWriter writes the message files of the built-in formats, where
+// --layout puts them.
+type formatWriter struct {
+	format string
+}
+
+// exportRoot returns the way up from dir, a folder of the export, to its
+// top, such as ../.. for html/channel.
+func exportRoot(dir string) string {
+	root := "."
+	for _, part := range strings.Split(path.Clean(dir), "/") {
+		if part != "." && part != "" {
+			root = path.Join(root, "..")
+		}
+	}
+	return root
+}
+
+// withNewlines returns data, rendered with \n line endings, with those
+// that --newline asks for.
+func withNewlines(data []byte, opts *options) []byte {
+	if !opts.crlf {
+		return data
+	}
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(data, []byte("\n"), []byte("\r\n"), -1)
+}
+
+func (w *formatWriter) WriteChannel(ctx OutputContext, meta ChannelMeta, msgs []slack.Message) error {
+	opts := ctx.Opts
+	for _, group := range ctx.Layout.splitByDay(msgs) {
+		formatDir, base, err := ctx.Folder(meta, w.format, group.day)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		switch w.format {
+		case "json":
+			if len(opts.fields) > 0 {
+				var projected []map[string]json.RawMessage
+				if projected, err = projectMessages(group.messages, opts.fields); err == nil {
+					data, err = MarshalIndent(projected, "", "    ")
+				}
+			} else {
+				data, err = MarshalIndent(group.messages, "", "    ")
+			}
+		case "text":
+			data = renderText(group.messages, &meta, ctx.UsersMap, opts)
+		case "html":
+			data = renderHTML(group.messages, &meta, ctx.UsersMap, opts)
+		case "md":
+			root := exportRoot(ctx.Layout.dir(ctx.ChannelPath, sanitizeName(meta.Name), w.format))
+			data = renderMarkdown(group.messages, &meta, ctx.UsersMap, root, opts)
+		case "csv":
+			data = renderCSV(group.messages, &meta, ctx.UsersMap, opts)
+		case "discord":
+			data = renderDiscord(group.messages, &meta, ctx.UsersMap, opts)
+		case "mbox":
+			data = renderMbox(group.messages, &meta, ctx.UsersMap, opts)
+		}
+		if err != nil {
+			return err
+		}
+		if w.format == "text" || w.format == "md" || w.format == "csv" {
+			data = withNewlines(data, opts)
+		}
+
+		if err := writeFileIfChanged(path.Join(formatDir, base+formatExtensions[w.format]), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// forEach calls fn for every index from 0 to n-1, running up to workers
+// calls at the same time, and returns once they have all finished. When
+// delay is set it is waited out before handing out each index after the
+// first.
+func forEach(n, workers int, delay time.Duration, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if i > 0 && delay > 0 {
+			sleepUntilTimeout(delay)
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
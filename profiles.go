@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/nlopes/slack"
+)
+
+// profileFieldLabels returns the labels of the workspace's custom profile
+// fields, such as Department or Manager, by field ID.
+func profileFieldLabels(opts *options) (map[string]string, error) {
+	var profile struct {
+		Profile struct {
+			Fields []struct {
+				ID    string `json:"id"`
+				Label string `json:"label"`
+			} `json:"fields"`
+		} `json:"profile"`
+	}
+	sleepBeforeFetchIfNeeded()
+	if err := callAPI(opts, "team.profile.get", url.Values{}, &profile); err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string, len(profile.Profile.Fields))
+	for _, field := range profile.Profile.Fields {
+		labels[field.ID] = field.Label
+	}
+	return labels, nil
+}
+
+// addCustomFields fills in the custom profile fields of users, which
+// users.list leaves out, each with its label. They are asked for user by
+// user; deleted users and bots, which have none, are skipped. A workspace
+// without custom fields costs one call.
+func addCustomFields(api *slack.Client, users []slack.User, opts *options) {
+	labels, err := profileFieldLabels(opts)
+	if err != nil {
+		addWarning("could not get the custom profile fields of the workspace: %v", err)
+		return
+	}
+	if len(labels) == 0 {
+		return
+	}
+
+	for i := range users {
+		if users[i].Deleted || users[i].IsBot {
+			continue
+		}
+		if timedOut() {
+			return
+		}
+		sleepBeforeFetchIfNeeded()
+		profile, err := api.GetUserProfile(users[i].ID, false)
+		if err != nil {
+			addWarning("could not get the custom profile fields of %s: %v", users[i].Name, err)
+			continue
+		}
+		fields := profile.Fields.ToMap()
+		for ID, field := range fields {
+			field.Label = labels[ID]
+			fields[ID] = field
+		}
+		users[i].Profile.Fields.SetMap(fields)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import "time"
+
+// historyProgress reports how far the fetch of one conversation's history
+// has got. Slack has no cheap way to count a channel's messages, so the
+// first page stands in for one: when it is the only page the total is
+// known, otherwise the count keeps going until Slack runs out of pages.
+type historyProgress struct {
+	name    string
+	fetched int
+	pages   int
+	total   int // 0 while the total is unknown
+	started time.Time
+}
+
+func newHistoryProgress(name string) *historyProgress {
+	return &historyProgress{name: name, started: time.Now()}
+}
+
+// page records one page of history. hasMore is the page's HasMore, and
+// took is how long Slack took to send it. The time between pages that is not
+// spent waiting for Slack goes to pacing and to this program.
+func (p *historyProgress) page(messages int, hasMore bool, took time.Duration) {
+	first := p.fetched == 0
+	p.fetched += messages
+	p.pages++
+	fields := p.fields()
+	fields["page"] = p.pages
+	fields["elapsed_ms"] = took.Milliseconds()
+	debugWith(fields, "  %s: page %d, %d messages in %s (%s since the first page was asked for)",
+		p.name, p.pages, messages, took.Round(time.Millisecond), time.Since(p.started).Round(time.Millisecond))
+	switch {
+	case first && !hasMore:
+		p.total = p.fetched
+	case hasMore:
+		logWith(p.fields(), "  %s: %d messages so far, more to come", p.name, p.fetched)
+	}
+}
+
+// done reports the end of the fetch.
+func (p *historyProgress) done() {
+	if p.total > 0 {
+		logWith(p.fields(), "  %s: %d/%d messages", p.name, p.fetched, p.total)
+	} else {
+		logWith(p.fields(), "  %s: %d messages", p.name, p.fetched)
+	}
+}
+
+func (p *historyProgress) fields() logFields {
+	return logFields{"channel": p.name, "message_count": p.fetched}
+}
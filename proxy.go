@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// baseTransport sends every request the program makes, to the Slack API and
+// for file downloads. Like Go's default transport, it goes through the proxy
+// named by HTTPS_PROXY, HTTP_PROXY and NO_PROXY unless --proxy or --no-proxy
+// says otherwise.
+var baseTransport http.RoundTripper = http.DefaultTransport
+
+// setupProxy sets baseTransport up from the proxy flags, and exits with
+// the usage help when they make no sense.
+func setupProxy(c *cli.Context) {
+	proxy := flagFrom(c, "proxy")
+	noProxy := flagContext(c, "no-proxy").Bool("no-proxy")
+	if proxy == "" && !noProxy {
+		return
+	}
+
+	var proxyURL *url.URL
+	var err error
+	if proxy != "" {
+		proxyURL, err = url.Parse(proxy)
+	}
+	if (proxy != "" && noProxy) || err != nil || (proxyURL != nil && proxyURL.Host == "") {
+		fmt.Println("ERROR: the proxy flag must be a URL such as http://proxy:3128, and cannot go with no-proxy...")
+		fmt.Println("")
+		cli.ShowAppHelp(c)
+		os.Exit(exitUsage)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	baseTransport = transport
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// completeReactions fills in the reactors that Slack left out of the
+// messages' reactions. The history only lists the first few users of each
+// reaction, so the messages where the count is higher are asked for again
+// with reactions.get. A message Slack won't tell about is kept as it is,
+// with a warning.
+func completeReactions(messages []slack.Message, meta *ChannelMeta, opts *options) {
+	for i, msg := range messages {
+		if !reactionsCut(msg.Reactions) {
+			continue
+		}
+
+		var item struct {
+			Message struct {
+				Reactions []slack.ItemReaction `json:"reactions"`
+			} `json:"message"`
+		}
+		params := url.Values{"channel": {meta.ID}, "timestamp": {msg.Timestamp}, "full": {"true"}}
+		sleepBeforeFetchIfNeeded()
+		if err := callAPI(opts, "reactions.get", params, &item); err != nil {
+			addWarning("could not get all the reactions to message %s in %s: %v", msg.Timestamp, meta.Name, err)
+			continue
+		}
+		messages[i].Reactions = item.Message.Reactions
+	}
+}
+
+// reactionsCut reports whether any of reactions lists fewer users than it
+// counts.
+func reactionsCut(reactions []slack.ItemReaction) bool {
+	for _, reaction := range reactions {
+		if len(reaction.Users) < reaction.Count {
+			return true
+		}
+	}
+	return false
+}
+
+// reactors returns the names of the users who reacted with reaction.
+func reactors(reaction slack.ItemReaction, usersMap UsersMap, opts *options) []string {
+	var names []string
+	for _, ID := range reaction.Users {
+		user, ok := usersMap.get(ID)
+		if !ok {
+			user = &UserInfo{Login: ID, RealName: ID}
+		}
+		names = append(names, user.Label(opts.nameField))
+	}
+	return names
+}
+
+// textReactions returns the reactions to msg with who reacted, as shown
+// under the message in the text output: ":+1: alice, bob  :tada: carol".
+func textReactions(msg slack.Message, usersMap UsersMap, opts *options) string {
+	var parts []string
+	for _, reaction := range msg.Reactions {
+		emoji := ":" + reaction.Name + ":"
+		if opts.emojiUnicode {
+			emoji = emojiUnicode(emoji)
+		}
+		parts = append(parts, emoji+" "+strings.Join(reactors(reaction, usersMap, opts), ", "))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// htmlReactions is textReactions for the HTML output.
+func htmlReactions(msg slack.Message, usersMap UsersMap, opts *options) string {
+	var parts []string
+	for _, reaction := range msg.Reactions {
+		names := strings.Join(reactors(reaction, usersMap, opts), ", ")
+		parts = append(parts, `<span class="reaction">:`+html.EscapeString(reaction.Name)+": "+html.EscapeString(names)+"</span>")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"container/heap"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// recentMessage is a message of recent.json, with the conversation it was
+// posted in.
+type recentMessage struct {
+	Channel   string        `json:"channel"`
+	ChannelID string        `json:"channel_id"`
+	Message   slack.Message `json:"message"`
+}
+
+// recentHeap holds the newest messages met so far, the oldest of them on
+// top, so that it can be dropped when a newer one comes.
+type recentHeap []recentMessage
+
+func (h recentHeap) Len() int            { return len(h) }
+func (h recentHeap) Less(i, j int) bool  { return h[i].Message.Timestamp < h[j].Message.Timestamp }
+func (h recentHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *recentHeap) Push(x interface{}) { *h = append(*h, x.(recentMessage)) }
+func (h *recentHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+var recentMessages recentHeap
+var recentMessagesMutex sync.Mutex
+
+// addRecentMessages offers the messages of a conversation to recent.json,
+// which keeps the opts.recentMessages newest of all the conversations.
+func addRecentMessages(meta *ChannelMeta, messages []slack.Message, opts *options) {
+	recentMessagesMutex.Lock()
+	defer recentMessagesMutex.Unlock()
+	for _, msg := range messages {
+		if len(recentMessages) < opts.recentMessages {
+			heap.Push(&recentMessages, recentMessage{meta.Name, meta.ID, msg})
+		} else if msg.Timestamp > recentMessages[0].Message.Timestamp {
+			recentMessages[0] = recentMessage{meta.Name, meta.ID, msg}
+			heap.Fix(&recentMessages, 0)
+		}
+	}
+}
+
+// writeRecentMessages saves the newest messages of all the conversations
+// dumped to recent.json, in the order of the message files.
+func writeRecentMessages(dir string, opts *options) {
+	if opts.recentMessages <= 0 {
+		return
+	}
+	messages := []recentMessage(recentMessages)
+	if messages == nil {
+		messages = []recentMessage{}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if opts.newestFirst {
+			return messages[i].Message.Timestamp > messages[j].Message.Timestamp
+		}
+		return messages[i].Message.Timestamp < messages[j].Message.Timestamp
+	})
+
+	data, err := MarshalIndent(messages, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "recent.json"), data, 0644)
+	check(err)
+}
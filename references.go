@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// channelMentionRE matches a mention of a channel in message text, which
+// carries the channel's name unless the message is old.
+var channelMentionRE = regexp.MustCompile(`<#([CG][0-9A-Z]+)(?:\|([^<>]*))?>`)
+
+// channelReference is how often the messages of one conversation mention a
+// channel, as listed in references.json.
+type channelReference struct {
+	From   string `json:"from"`
+	FromID string `json:"from_id"`
+	To     string `json:"to"`
+	ToID   string `json:"to_id"`
+	Count  int    `json:"count"`
+}
+
+// channelReferences are the references counted so far, by the IDs of the
+// conversation and of the channel it mentions. referenceNames holds the
+// names the IDs were met with.
+var channelReferences = map[[2]string]int{}
+var referenceNames = map[string]string{}
+var channelReferencesMutex sync.Mutex
+
+// addChannelReferences counts the channels the messages of a conversation
+// mention, other than itself.
+func addChannelReferences(meta *ChannelMeta, messages []slack.Message) {
+	channelReferencesMutex.Lock()
+	defer channelReferencesMutex.Unlock()
+	referenceNames[meta.ID] = meta.Name
+	for _, msg := range messages {
+		for _, m := range channelMentionRE.FindAllStringSubmatch(msg.Text, -1) {
+			if m[1] == meta.ID {
+				continue
+			}
+			channelReferences[[2]string{meta.ID, m[1]}]++
+			if _, ok := referenceNames[m[1]]; !ok && m[2] != "" {
+				referenceNames[m[1]] = m[2]
+			}
+		}
+	}
+}
+
+// writeReferences saves references.json, the graph of which conversations
+// mention which channels and how often, most mentioned first. channels are
+// those dumped; the names of the channels they mention are taken from them
+// where they can be, or else from the mentions.
+func writeReferences(dir string, channels []slack.Channel) {
+	if len(channelReferences) == 0 {
+		return
+	}
+	for _, channel := range channels {
+		referenceNames[channel.ID] = channel.Name
+	}
+
+	references := make([]channelReference, 0, len(channelReferences))
+	for IDs, count := range channelReferences {
+		references = append(references, channelReference{
+			From:   referenceNames[IDs[0]],
+			FromID: IDs[0],
+			To:     referenceNames[IDs[1]],
+			ToID:   IDs[1],
+			Count:  count,
+		})
+	}
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Count != references[j].Count {
+			return references[i].Count > references[j].Count
+		}
+		if references[i].FromID != references[j].FromID {
+			return references[i].FromID < references[j].FromID
+		}
+		return references[i].ToID < references[j].ToID
+	})
+
+	data, err := MarshalIndent(references, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "references.json"), data, 0644)
+	check(err)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// tokenRefresher renews a rotating access token with its refresh token
+// when Slack says it has expired. Slack hands out a new refresh token with
+// every new access token, so it is written back to its file each time.
+type tokenRefresher struct {
+	mu           sync.Mutex
+	token        string
+	refreshFile  string
+	clientID     string
+	clientSecret string
+	apiURL       string
+}
+
+// refresher is set when the run was given a refresh token.
+var refresher *tokenRefresher
+
+// current returns the access token to use now.
+func (r *tokenRefresher) current() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.token
+}
+
+// refresh gets a new access token, unless the stale one has already been
+// replaced by another worker.
+func (r *tokenRefresher) refresh(stale string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token != stale {
+		return nil
+	}
+
+	refreshToken, err := ioutil.ReadFile(r.refreshFile)
+	if err != nil {
+		return err
+	}
+	params := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {strings.TrimSpace(string(refreshToken))},
+		"client_id":     {r.clientID},
+		"client_secret": {r.clientSecret},
+	}
+	client := &http.Client{Transport: countingTransport{baseTransport}}
+	resp, err := client.PostForm(r.apiURL+"oauth.v2.access", params)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var access struct {
+		OK           bool   `json:"ok"`
+		Error        string `json:"error"`
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&access); err != nil {
+		return err
+	}
+	if !access.OK {
+		return fmt.Errorf("%s", access.Error)
+	}
+
+	if access.RefreshToken != "" {
+		if err := ioutil.WriteFile(r.refreshFile, []byte(access.RefreshToken+"\n"), 0600); err != nil {
+			return err
+		}
+	}
+	r.token = access.AccessToken
+	logf("the access token expired and was refreshed")
+	return nil
+}
+
+// withTokenRefresh makes requests sent through base carry the current
+// access token, and sends a request once more with a new one when Slack
+// answers that the token has expired. Without a refresh token it is base.
+func withTokenRefresh(base http.RoundTripper) http.RoundTripper {
+	if refresher == nil {
+		return base
+	}
+	return refreshingTransport{base: base, tokens: refresher}
+}
+
+type refreshingTransport struct {
+	base   http.RoundTripper
+	tokens *tokenRefresher
+}
+
+func (t refreshingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token := t.tokens.current()
+	resp, err := t.base.RoundTrip(withToken(req, body, token))
+	if err != nil || !tokenExpired(resp) {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err := t.tokens.refresh(token); err != nil {
+		return nil, fmt.Errorf("could not refresh the access token: %v", err)
+	}
+	return t.base.RoundTrip(withToken(req, body, t.tokens.current()))
+}
+
+// withToken returns a copy of req that carries token wherever the slack
+// package or this program put one: the token form field or query parameter
+// and the Authorization header.
+func withToken(req *http.Request, body []byte, token string) *http.Request {
+	out := req.Clone(req.Context())
+	if out.Header.Get("Authorization") != "" {
+		out.Header.Set("Authorization", "Bearer "+token)
+	}
+	if query := out.URL.Query(); query.Get("token") != "" {
+		query.Set("token", token)
+		out.URL.RawQuery = query.Encode()
+	}
+	if strings.HasPrefix(out.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil && form.Get("token") != "" {
+			form.Set("token", token)
+			body = []byte(form.Encode())
+		}
+	}
+	if body != nil {
+		out.Body = ioutil.NopCloser(bytes.NewReader(body))
+		out.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		out.ContentLength = int64(len(body))
+	}
+	return out
+}
+
+// tokenExpired reports whether resp is Slack's token_expired error. The
+// body of an API answer is read to tell, and put back for the caller; file
+// downloads are left alone.
+func tokenExpired(resp *http.Response) bool {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return false
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	var status struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(data, &status) == nil && status.Error == "token_expired"
+}
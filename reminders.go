@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+
+	"github.com/nlopes/slack"
+)
+
+// reminderAddRE matches the text of the message Slack posts when /remind
+// sets up a reminder in a conversation: what to be reminded of, and when.
+var reminderAddRE = regexp.MustCompile(`^set up a reminder “(.*)” (?:in this channel|for [^ ]+) (?:at|on|in|every) (.*?)\.?$`)
+
+// reminderText returns what the renderers show for a reminder_add message:
+// who set up the reminder, for what and for when, as far as its text tells.
+// Like any message text, it keeps the entities Slack escaped it with; the
+// name of who set it up is put in through label.
+func reminderText(msg slack.Message, usersMap UsersMap, opts *options, label func(string) string) string {
+	author := label(messageAuthor(msg, usersMap, opts))
+	m := reminderAddRE.FindStringSubmatch(msg.Text)
+	if m == nil {
+		return author + " " + msg.Text
+	}
+	return "Reminder set by " + author + ": “" + m[1] + "”, for " + m[2]
+}
+
+// dumpReminders writes the reminders of the token's user to reminders.json,
+// as Slack lists them. The slack package has no call for it, so the Web API
+// is asked directly; a token without the reminders:read scope is reported as
+// a warning.
+func dumpReminders(dir string, opts *options) {
+	logf("dump reminders")
+
+	var list struct {
+		Reminders []json.RawMessage `json:"reminders"`
+	}
+	sleepBeforeFetchIfNeeded()
+	if err := callAPI(opts, "reminders.list", url.Values{}, &list); err != nil {
+		addWarning("could not get the reminders: %v", err)
+		return
+	}
+
+	data, err := MarshalIndent(list.Reminders, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "reminders.json"), data, 0644)
+	check(err)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/nlopes/slack"
+)
+
+// channelRename is one renaming of a conversation, found in its history
+// and recorded with it in channels.json.
+type channelRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	TS   string `json:"ts"`
+	User string `json:"user,omitempty"`
+}
+
+// channelRenames are the renamings found so far, oldest first, by the ID of
+// the conversation.
+var channelRenames = map[string][]channelRename{}
+var channelRenamesMutex sync.Mutex
+
+// addChannelRenames records the channel_name and group_name messages of a
+// conversation, which Slack posts when it is renamed. Files keep going by
+// the conversation's current name.
+func addChannelRenames(meta *ChannelMeta, messages []slack.Message) {
+	var renames []channelRename
+	for _, msg := range messages {
+		if msg.SubType == "channel_name" || msg.SubType == "group_name" {
+			renames = append(renames, channelRename{From: msg.OldName, To: msg.Name, TS: msg.Timestamp, User: msg.User})
+		}
+	}
+	if len(renames) == 0 {
+		return
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		return tsMicros(renames[i].TS) < tsMicros(renames[j].TS)
+	})
+
+	channelRenamesMutex.Lock()
+	defer channelRenamesMutex.Unlock()
+	channelRenames[meta.ID] = renames
+}
+
+// exportedChannel is an entry of channels.json: the channel as Slack
+// describes it, with the renamings found in its history.
+type exportedChannel struct {
+	slack.Channel
+	Renames []channelRename `json:"renames,omitempty"`
+}
+
+// withRenames returns channels as channels.json lists them.
+func withRenames(channels []slack.Channel) []exportedChannel {
+	exported := make([]exportedChannel, len(channels))
+	for i, channel := range channels {
+		exported[i] = exportedChannel{channel, channelRenames[channel.ID]}
+	}
+	return exported
+}
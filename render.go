@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+.meta { color: #666; }
+.message { margin: 0.4em 0; }
+.time, .time a { color: #999; font-size: small; }
+.author { font-weight: bold; }
+.subtype { color: #666; font-style: italic; }
+.external { border-left: 3px solid #e8a33d; padding-left: 0.5em; }
+.reactions { color: #666; font-size: small; }
+.reaction { margin-right: 1em; }
+pre { background: #f4f4f4; padding: 0.5em; white-space: pre-wrap; }
+blockquote { border-left: 3px solid #ccc; margin: 0; padding-left: 0.5em; }
+</style>
+</head>
+<body>
+`
+
+// permalink returns the address of the message posted at ts in Slack, or
+// "" when the workspace's address is not known. It is built the way Slack
+// builds them, which saves asking for each one.
+func permalink(meta *ChannelMeta, ts string, opts *options) string {
+	if opts.teamURL == "" || ts == "" {
+		return ""
+	}
+	return strings.TrimSuffix(opts.teamURL, "/") + "/archives/" + meta.ID + "/p" + strings.Replace(ts, ".", "", 1)
+}
+
+// timeLink returns the time of a message in HTML, linked to the message
+// in Slack when its address is known.
+func timeLink(t string, link string) string {
+	if link == "" {
+		return t
+	}
+	return `<a href="` + html.EscapeString(link) + `">` + t + "</a>"
+}
+
+// channelTitle returns how a conversation is named in rendered output.
+func channelTitle(meta *ChannelMeta) string {
+	if meta.Type == "dm" {
+		return "Direct message with " + meta.Name
+	}
+	return "#" + meta.Name
+}
+
+func renderHTML(messages []slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) []byte {
+	var b bytes.Buffer
+	title := html.EscapeString(channelTitle(meta))
+	fmt.Fprintf(&b, htmlHead, title)
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", title)
+	if meta.Topic != "" {
+		fmt.Fprintf(&b, "<p class=\"meta\">Topic: %s</p>\n", html.EscapeString(meta.Topic))
+	}
+	if meta.Purpose != "" {
+		fmt.Fprintf(&b, "<p class=\"meta\">Purpose: %s</p>\n", html.EscapeString(meta.Purpose))
+	}
+
+	lastDay := ""
+	for _, msg := range messages {
+		// Each message can be linked to as #ts-<its ts>.
+		timestamp, ts := parsePreciseTimestamp(msg.Timestamp)
+		if newDay(timestamp, &lastDay) {
+			fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(formatDay(timestamp, opts)))
+		}
+
+		text := convertMrkdwn(messageHTML(msg, meta, usersMap, opts), htmlTarget)
+		when := timeLink(formatTime(timestamp, opts.timeFormat), permalink(meta, ts, opts))
+		if opts.reactionsDetail && len(msg.Reactions) > 0 {
+			text += "<div class=\"reactions\">" + htmlReactions(msg, usersMap, opts) + "</div>"
+		}
+		class := "message"
+		if externalMessage(msg, usersMap, opts) {
+			class += " external"
+		}
+		if msg.SubType == "" {
+			fmt.Fprintf(&b, "<div class=\"%s\" id=\"ts-%s\"><span class=\"time\">%s</span> <span class=\"author\">%s</span><div class=\"text\">%s</div></div>\n",
+				class, ts, when, html.EscapeString(messageAuthor(msg, usersMap, opts)), text)
+		} else {
+			fmt.Fprintf(&b, "<div class=\"%s subtype\" id=\"ts-%s\"><span class=\"time\">%s</span> %s</div>\n",
+				class, ts, when, text)
+		}
+	}
+
+	b.WriteString("</body>\n</html>\n")
+	return b.Bytes()
+}
+
+// renderMarkdown renders messages as Markdown. root is the way from the
+// folder of the Markdown file up to the top of the export, such as "..",
+// which the links to downloaded files start from.
+func renderMarkdown(messages []slack.Message, meta *ChannelMeta, usersMap UsersMap, root string, opts *options) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", channelTitle(meta))
+	if meta.Topic != "" {
+		fmt.Fprintf(&b, "**Topic:** %s  \n", meta.Topic)
+	}
+	if meta.Purpose != "" {
+		fmt.Fprintf(&b, "**Purpose:** %s  \n", meta.Purpose)
+	}
+
+	lastDay := ""
+	for _, msg := range messages {
+		timestamp := parseTimestamp(msg.Timestamp)
+		if newDay(timestamp, &lastDay) {
+			fmt.Fprintf(&b, "\n## %s\n\n", formatDay(timestamp, opts))
+		}
+
+		text := messageText(msg, meta, usersMap, opts)
+		if opts.emojiUnicode {
+			text = emojiUnicode(text)
+		}
+		text = convertMrkdwn(text, markdownTarget)
+		if files := markdownFiles(msg, root, opts); files != "" {
+			text += "  \n" + files
+		}
+		when := formatTime(timestamp, opts.timeFormat)
+		if link := permalink(meta, msg.Timestamp, opts); link != "" {
+			when = "[" + when + "](" + link + ")"
+		}
+		if msg.SubType == "" {
+			fmt.Fprintf(&b, "**%s** %s  \n%s\n\n", messageAuthor(msg, usersMap, opts), when, text)
+		} else {
+			fmt.Fprintf(&b, "_%s %s_\n\n", when, text)
+		}
+	}
+	return b.Bytes()
+}
+
+// markdownFiles returns the files of msg as Markdown links, images shown
+// inline, pointing at where they were downloaded to or, when they were not,
+// at the files in Slack.
+func markdownFiles(msg slack.Message, root string, opts *options) string {
+	var links []string
+	for _, f := range messageFiles(msg) {
+		title := f.Title
+		if title == "" {
+			title = f.Name
+		}
+		image := strings.HasPrefix(f.Mimetype, "image/")
+
+		link := f.Permalink
+		if link == "" {
+			link = f.URLPrivate
+		}
+		if opts.downloadFiles || opts.thumbnailsOnly {
+			if source, target, _ := downloadTarget(f, opts); source != "" {
+				link = (&url.URL{Path: path.Join(root, target)}).String()
+				image = image || opts.thumbnailsOnly
+			}
+		}
+		if link == "" {
+			continue
+		}
+
+		title = strings.NewReplacer("[", "\\[", "]", "\\]").Replace(title)
+		if image {
+			links = append(links, "!["+title+"]("+link+")")
+		} else {
+			links = append(links, "["+title+"]("+link+")")
+		}
+	}
+	return strings.Join(links, "  \n")
+}
+
+func renderCSV(messages []slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"time", "ts", "user", "author", "subtype", "text", "external"})
+	for _, msg := range messages {
+		w.Write([]string{
+			formatTime(parseTimestamp(msg.Timestamp), time.RFC3339),
+			msg.Timestamp,
+			msg.User,
+			messageAuthor(msg, usersMap, opts),
+			msg.SubType,
+			slackEntities.Replace(messageText(msg, meta, usersMap, opts)),
+			strconv.FormatBool(externalMessage(msg, usersMap, opts)),
+		})
+	}
+	w.Flush()
+	check(w.Error())
+	return b.Bytes()
+}
+
+// renderWarning is a message that may show up incomplete in the text, HTML,
+// Markdown and CSV output, as saved in render-warnings.json.
+type renderWarning struct {
+	Channel   string `json:"channel"`
+	Timestamp string `json:"ts"`
+	Problem   string `json:"problem"`
+}
+
+var renderWarnings []renderWarning
+var renderWarningsMutex sync.Mutex
+
+// rendered reports whether formats has any format rendered from the message
+// texts, rather than written as Slack sent them.
+func rendered(formats []string) bool {
+	for _, format := range formats {
+		if format != "json" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRendering records the messages of a conversation that the renderers
+// cannot show in full: those mentioning users or user groups whose names are
+// unknown, and those whose content is all in attachments or in blocks that
+// hold no text.
+func checkRendering(messages []slack.Message, meta *ChannelMeta, usersMap UsersMap, opts *options) {
+	var found []renderWarning
+	add := func(msg slack.Message, format string, a ...interface{}) {
+		found = append(found, renderWarning{meta.Name, msg.Timestamp, fmt.Sprintf(format, a...)})
+	}
+
+	for _, msg := range messages {
+		if user, ok := usersMap.get(msg.User); msg.User != "" && (!ok || user.Unknown) {
+			add(msg, "author %s is unknown", msg.User)
+		}
+		for _, mention := range mentionRE.FindAllString(msg.Text, -1) {
+			ID := mention[2 : len(mention)-1]
+			if user, ok := usersMap.get(ID); !ok || user.Unknown {
+				add(msg, "mentioned user %s is unknown", ID)
+			}
+		}
+		for _, m := range subteamRE.FindAllStringSubmatch(msg.Text, -1) {
+			if _, ok := opts.userGroups[m[1]]; !ok && m[2] == "" {
+				add(msg, "mentioned user group %s is unknown", m[1])
+			}
+		}
+		if msg.Text == "" && blocksText(msg.Blocks) == "" && (len(msg.Blocks.BlockSet) > 0 || len(msg.Attachments) > 0) {
+			add(msg, "the message only has attachments or blocks without text, which are not rendered")
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+
+	logf("  %s: %d problems rendering messages, see render-warnings.json", meta.Name, len(found))
+	renderWarningsMutex.Lock()
+	renderWarnings = append(renderWarnings, found...)
+	renderWarningsMutex.Unlock()
+}
+
+func writeRenderWarnings(dir string) {
+	if len(renderWarnings) == 0 {
+		return
+	}
+	data, err := MarshalIndent(renderWarnings, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "render-warnings.json"), data, 0644)
+	check(err)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// callAttempts is how many times one API call is tried before its
+	// error is handed back.
+	callAttempts = 5
+	// maxRetryDelay caps the wait before a retry.
+	maxRetryDelay = time.Minute
+)
+
+// retryBudget is how many retries the whole run may make, API calls and
+// file downloads together, set by --retry-budget. Once it is spent the run
+// stops, so that a Slack outage does not turn into hours of retrying
+// channel after channel. 0 means no limit.
+var retryBudget int64 = 100
+
+// takeRetry counts a retry against the budget, and ends the run when
+// there is none left.
+func takeRetry() {
+	used := atomic.AddInt64(&stats.Retries, 1)
+	if retryBudget > 0 && used > retryBudget {
+		logf("ERROR: giving up after %d retries in this run, Slack does not seem to be working...", retryBudget)
+		os.Exit(exitNetwork)
+	}
+}
+
+// retryingTransport sends a request again when it fails to get through,
+// when Slack answers 429 Too Many Requests, waiting as long as Slack asks,
+// or when it answers with a server error.
+type retryingTransport struct {
+	base http.RoundTripper
+}
+
+func (t retryingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.WithContext(runContext)
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err = timeoutError(err); err == errTimeout {
+			return nil, err
+		}
+		retry := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retry || attempt == callAttempts || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		delay := retryDelay(resp, attempt)
+		if err != nil {
+			logWith(logFields{"retry": attempt}, "  %s failed (%v), retrying in %s", req.URL.Path, err, delay)
+		} else {
+			logWith(logFields{"retry": attempt}, "  %s got %s, retrying in %s", req.URL.Path, resp.Status, delay)
+			resp.Body.Close()
+		}
+		takeRetry()
+		if err := sleepUntilTimeout(delay); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryDelay returns how long to wait before the next attempt: what a
+// Retry-After header asks for, or else a delay that doubles with each
+// attempt. Workers that were turned away together would come back together
+// and be turned away again, so the delay is spread by up to a fifth either
+// way, and by up to a fifth more on top of Retry-After, which Slack does not
+// want cut short.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	delay := time.Second << uint(attempt-1)
+	spread := rand.Float64()*0.4 - 0.2
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+			spread = rand.Float64() * 0.2
+		}
+	}
+	delay += time.Duration(float64(delay) * spread)
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nlopes/slack"
+)
+
+// maxMessageBytes is the size, as JSON, above which a message is left out
+// of the files. Real messages are at most a few tens of kilobytes; bigger
+// ones come from integrations gone wrong.
+const maxMessageBytes = 1 << 20
+
+// sanitizeMessages returns messages fit to be written: invalid UTF-8 in
+// their texts is replaced with U+FFFD, and oversized messages are replaced
+// by a placeholder that keeps their ts, author and type. Both are reported
+// as warnings.
+func sanitizeMessages(messages []slack.Message, meta *ChannelMeta) []slack.Message {
+	fixed := 0
+	for i := range messages {
+		msg := &messages[i]
+		if fixUTF8(msg) {
+			fixed++
+		}
+
+		data, err := json.Marshal(msg)
+		if err != nil || len(data) > maxMessageBytes {
+			addWarning("message %s in %s is too big to be written (%d bytes), it was left out", msg.Timestamp, meta.Name, len(data))
+			placeholder := slack.Message{}
+			placeholder.Type = msg.Type
+			placeholder.SubType = msg.SubType
+			placeholder.Timestamp = msg.Timestamp
+			placeholder.ThreadTimestamp = msg.ThreadTimestamp
+			placeholder.User = msg.User
+			placeholder.BotID = msg.BotID
+			placeholder.Text = "(message left out by slack-dump: too big to be written)"
+			*msg = placeholder
+		}
+	}
+	if fixed > 0 {
+		addWarning("%d messages in %s had invalid UTF-8, which was replaced", fixed, meta.Name)
+	}
+	return messages
+}
+
+// fixUTF8 replaces invalid UTF-8 in the texts of msg and its attachments,
+// and reports whether there was any. The attachments are copied first, as
+// other copies of the message may share them.
+func fixUTF8(msg *slack.Message) bool {
+	fixed := false
+	fix := func(s *string) {
+		if !utf8.ValidString(*s) {
+			*s = strings.ToValidUTF8(*s, "\uFFFD")
+			fixed = true
+		}
+	}
+
+	fix(&msg.Text)
+	attachments := append([]slack.Attachment(nil), msg.Attachments...)
+	for i := range attachments {
+		a := &attachments[i]
+		for _, s := range []*string{&a.Fallback, &a.Pretext, &a.Title, &a.Text} {
+			fix(s)
+		}
+	}
+	if fixed && len(attachments) > 0 {
+		msg.Attachments = attachments
+	}
+	return fixed
+}
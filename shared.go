@@ -0,0 +1,34 @@
+package main
+
+import "github.com/nlopes/slack"
+
+// conversationsHistory fetches history with conversations.history, for the
+// channels shared with other workspaces through Slack Connect. The older
+// channels.history and groups.history the other channels are fetched with
+// can leave out the messages posted from the other side.
+func conversationsHistory(api *slack.Client) historyFunc {
+	return func(ID string, params slack.HistoryParameters) (*slack.History, error) {
+		resp, err := api.GetConversationHistory(&slack.GetConversationHistoryParameters{
+			ChannelID: ID,
+			Latest:    params.Latest,
+			Oldest:    params.Oldest,
+			Limit:     params.Count,
+			Inclusive: params.Inclusive,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &slack.History{Latest: resp.Latest, Messages: resp.Messages, HasMore: resp.HasMore}, nil
+	}
+}
+
+// externalMessage reports whether msg was posted from another workspace:
+// Slack says so with the team of the message, and otherwise its author is
+// not one of ours.
+func externalMessage(msg slack.Message, usersMap UsersMap, opts *options) bool {
+	if msg.Team != "" && opts.teamID != "" {
+		return msg.Team != opts.teamID
+	}
+	user, ok := usersMap.get(msg.User)
+	return ok && user.External
+}
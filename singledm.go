@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nlopes/slack"
+)
+
+// dumpSingleDM is the fast path for a lone @user argument. It dumps the DM
+// with that user without listing every user and channel of the workspace,
+// so users.json only holds the two people in the conversation. Errors in
+// the DM are dealt with as in any other conversation, by dumpConversation.
+func dumpSingleDM(api *slack.Client, dir string, who string, selfID string, opts *options) {
+	logf("dump user information")
+	user := lookupUser(api, who)
+	if user == nil {
+		logf("ERROR: the user %s does not exist...", who)
+		os.Exit(exitUsage)
+	}
+	users := []slack.User{*user}
+	if selfID != user.ID {
+		self, err := api.GetUserInfo(selfID)
+		check(err)
+		users = append(users, *self)
+	}
+
+	err := writeUsersFile(path.Join(dir, "users.json"), users)
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "channels.json"), []byte("[]"), 0644)
+	check(err)
+
+	usersMap := buildUsersMap(users, opts)
+
+	logf("dump direct message")
+	ims, err := api.GetIMChannels()
+	check(err)
+	for _, im := range ims {
+		if im.User == user.ID {
+			logf("dump DM with %s", user.Name)
+			if !dumpConversation(api, dir, imMeta(im, user.Name), usersMap, opts) {
+				logf("the DM with %s was left out", user.Name)
+			}
+			return
+		}
+	}
+	addWarning("there is no direct message with %s", user.Name)
+}
+
+// lookupUser finds a user by email address, ID or name. Only a name needs
+// the whole user list to be fetched.
+func lookupUser(api *slack.Client, who string) *slack.User {
+	if strings.Contains(who, "@") {
+		user, err := api.GetUserByEmail(who)
+		if err != nil {
+			return nil
+		}
+		return user
+	}
+
+	if who == strings.ToUpper(who) && (who[0] == 'U' || who[0] == 'W') {
+		if user, err := api.GetUserInfo(who); err == nil {
+			return user
+		}
+	}
+
+	users, err := fetchUsers(api)
+	check(err)
+	for i := range users {
+		if users[i].Name == who {
+			return &users[i]
+		}
+	}
+	return nil
+}
@@ -7,3 +7,21 @@ type byTimestamp []slack.Message
 func (m byTimestamp) Len() int           { return len(m) }
 func (m byTimestamp) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
 func (m byTimestamp) Less(i, j int) bool { return m[i].Timestamp < m[j].Timestamp }
+
+type byChannelName []slack.Channel
+
+func (c byChannelName) Len() int           { return len(c) }
+func (c byChannelName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byChannelName) Less(i, j int) bool { return c[i].Name < c[j].Name }
+
+type byGroupName []slack.Group
+
+func (g byGroupName) Len() int           { return len(g) }
+func (g byGroupName) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
+func (g byGroupName) Less(i, j int) bool { return g[i].Name < g[j].Name }
+
+type byMetaName []*ChannelMeta
+
+func (m byMetaName) Len() int           { return len(m) }
+func (m byMetaName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m byMetaName) Less(i, j int) bool { return m[i].Name < m[j].Name }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/nlopes/slack"
+)
+
+// dumpStars writes the items starred by the token's user to stars.json.
+func dumpStars(api *slack.Client, dir string) {
+	logf("dump starred items")
+
+	var items []slack.Item
+	params := slack.NewStarsParameters()
+	for params.Page = 1; ; params.Page++ {
+		sleepBeforeFetchIfNeeded()
+		page, paging, err := api.ListStars(params)
+		check(err)
+		items = append(items, page...)
+		if paging == nil || paging.Page >= paging.Pages {
+			break
+		}
+	}
+
+	// Stars on messages normally carry the message, but fetch it when not.
+	for i := range items {
+		if items[i].Type == "message" && items[i].Message == nil {
+			items[i].Message = fetchMessage(api, items[i].Channel, items[i].Timestamp)
+		}
+	}
+
+	data, err := MarshalIndent(items, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "stars.json"), data, 0644)
+	check(err)
+}
+
+// fetchMessage returns the message posted at ts in the conversation with
+// the given ID, or nil if it can no longer be found.
+func fetchMessage(api *slack.Client, ID, ts string) *slack.Message {
+	var get historyFunc
+	switch {
+	case len(ID) == 0:
+		return nil
+	case ID[0] == 'G':
+		get = api.GetGroupHistory
+	case ID[0] == 'D':
+		get = api.GetIMHistory
+	default:
+		get = api.GetChannelHistory
+	}
+
+	sleepBeforeFetchIfNeeded()
+	params := slack.NewHistoryParameters()
+	params.Latest = ts
+	params.Oldest = ts
+	params.Inclusive = true
+	params.Count = 1
+	history, err := get(ID, params)
+	if err != nil || len(history.Messages) == 0 {
+		return nil
+	}
+	return &history.Messages[0]
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// runStats counts what a run has done. The counters are updated from the
+// dump workers, so they must only be changed through sync/atomic, and the
+// activity only while holding activityMutex.
+type runStats struct {
+	Channels int64
+	Groups   int64
+	DMs      int64
+	Messages int64
+	Files    int64
+	Bytes    int64
+	APICalls int64
+	Retries  int64
+	Errors   int64
+
+	start           time.Time
+	activityMutex   sync.Mutex
+	activity        activity
+	channelActivity []channelActivity
+}
+
+// activity is when messages were posted, in the local time of the dump: how
+// many in each hour of the day, from 0 to 23, and on each day of the week,
+// from Sunday to Saturday.
+type activity struct {
+	HourOfDay [24]int64 `json:"hour_of_day"`
+	DayOfWeek [7]int64  `json:"day_of_week"`
+}
+
+// channelActivity is the activity of one conversation.
+type channelActivity struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Activity activity `json:"activity"`
+}
+
+var stats = &runStats{start: time.Now()}
+
+// addConversation counts a dumped conversation and its messages and files,
+// and adds the times its messages were posted to the activity.
+func (s *runStats) addConversation(meta *ChannelMeta, messages []slack.Message, files int) {
+	switch meta.Type {
+	case "group":
+		atomic.AddInt64(&s.Groups, 1)
+	case "dm":
+		atomic.AddInt64(&s.DMs, 1)
+	default:
+		atomic.AddInt64(&s.Channels, 1)
+	}
+	atomic.AddInt64(&s.Messages, int64(len(messages)))
+	atomic.AddInt64(&s.Files, int64(files))
+
+	var a activity
+	for _, msg := range messages {
+		if t := parseTimestamp(msg.Timestamp); t != nil {
+			a.HourOfDay[t.Hour()]++
+			a.DayOfWeek[t.Weekday()]++
+		}
+	}
+	s.activityMutex.Lock()
+	defer s.activityMutex.Unlock()
+	for i, n := range a.HourOfDay {
+		s.activity.HourOfDay[i] += n
+	}
+	for i, n := range a.DayOfWeek {
+		s.activity.DayOfWeek[i] += n
+	}
+	s.channelActivity = append(s.channelActivity, channelActivity{meta.Name, meta.Type, a})
+}
+
+// addError counts a conversation or a file that could not be dumped.
+func (s *runStats) addError() {
+	atomic.AddInt64(&s.Errors, 1)
+}
+
+// runReport is what a run has done, as saved in report.json.
+type runReport struct {
+	Channels int64   `json:"channels"`
+	Groups   int64   `json:"private_channels"`
+	DMs      int64   `json:"direct_messages"`
+	Messages int64   `json:"messages"`
+	Files    int64   `json:"files"`
+	Bytes    int64   `json:"bytes_downloaded"`
+	APICalls int64   `json:"api_calls"`
+	Retries  int64   `json:"retries"`
+	Errors   int64   `json:"errors"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// report returns the counters as they are now. It may be called while the
+// workers are still counting.
+func (s *runStats) report() runReport {
+	return runReport{
+		Channels: atomic.LoadInt64(&s.Channels),
+		Groups:   atomic.LoadInt64(&s.Groups),
+		DMs:      atomic.LoadInt64(&s.DMs),
+		Messages: atomic.LoadInt64(&s.Messages),
+		Files:    atomic.LoadInt64(&s.Files),
+		Bytes:    atomic.LoadInt64(&s.Bytes),
+		APICalls: atomic.LoadInt64(&s.APICalls),
+		Retries:  atomic.LoadInt64(&s.Retries),
+		Errors:   atomic.LoadInt64(&s.Errors),
+		Seconds:  time.Since(s.start).Round(time.Millisecond).Seconds(),
+	}
+}
+
+// writeReport saves the counters of the run to report.json.
+func (s *runStats) writeReport(dir string) {
+	data, err := MarshalIndent(s.report(), "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "report.json"), data, 0644)
+	check(err)
+}
+
+// writeStats saves the activity of the workspace and of each conversation
+// to stats.json.
+func (s *runStats) writeStats(dir string) {
+	s.activityMutex.Lock()
+	defer s.activityMutex.Unlock()
+	if s.channelActivity == nil {
+		s.channelActivity = []channelActivity{}
+	}
+	sort.Slice(s.channelActivity, func(i, j int) bool {
+		return s.channelActivity[i].Name < s.channelActivity[j].Name
+	})
+
+	data, err := MarshalIndent(struct {
+		Activity        activity          `json:"activity"`
+		ChannelActivity []channelActivity `json:"channel_activity"`
+	}{s.activity, s.channelActivity}, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "stats.json"), data, 0644)
+	check(err)
+}
+
+func (s *runStats) printSummary() {
+	r := s.report()
+	logf("dump finished in %s", time.Since(s.start).Round(time.Second))
+	logf("  public channels:  %d", r.Channels)
+	logf("  private channels: %d", r.Groups)
+	logf("  direct messages:  %d", r.DMs)
+	logf("  messages:         %d", r.Messages)
+	logf("  files:            %d", r.Files)
+	logf("  bytes downloaded: %d", r.Bytes)
+	logf("  API calls:        %d", r.APICalls)
+	logf("  retries:          %d", r.Retries)
+	logf("  errors:           %d", r.Errors)
+}
+
+// countingTransport counts every request made to the Slack API.
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&stats.APICalls, 1)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// TestRunStatsConcurrent updates and reads the counters from many
+// goroutines at once, as the dump workers do. Run it with -race.
+func TestRunStatsConcurrent(t *testing.T) {
+	s := &runStats{start: time.Now()}
+	messages := []slack.Message{
+		{Msg: slack.Msg{Timestamp: "1514764800.000100"}},
+		{Msg: slack.Msg{Timestamp: "1514768400.000200"}},
+	}
+	kinds := []string{"channel", "group", "dm"}
+
+	const workers = 30
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.addConversation(&ChannelMeta{Name: "c", Type: kinds[i%len(kinds)]}, messages, 3)
+			s.addError()
+			atomic.AddInt64(&s.Bytes, 100)
+			atomic.AddInt64(&s.APICalls, 2)
+			atomic.AddInt64(&s.Retries, 1)
+			s.report()
+		}(i)
+	}
+	wg.Wait()
+
+	got := s.report()
+	want := runReport{
+		Channels: workers / 3,
+		Groups:   workers / 3,
+		DMs:      workers / 3,
+		Messages: workers * 2,
+		Files:    workers * 3,
+		Bytes:    workers * 100,
+		APICalls: workers * 2,
+		Retries:  workers,
+		Errors:   workers,
+	}
+	got.Seconds = 0
+	if got != want {
+		t.Errorf("report() = %+v, want %+v", got, want)
+	}
+
+	var hours int64
+	for _, n := range s.activity.HourOfDay {
+		hours += n
+	}
+	if hours != workers*2 || len(s.channelActivity) != workers {
+		t.Errorf("activity counts %d messages in %d conversations, want %d in %d",
+			hours, len(s.channelActivity), workers*2, workers)
+	}
+}
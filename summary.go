@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nlopes/slack"
+)
+
+// snippetLength is how many characters of the last message summary.csv
+// shows.
+const snippetLength = 80
+
+// channelSummary is the last message of a channel, as listed in
+// summary.csv.
+type channelSummary struct {
+	name    string
+	kind    string
+	last    time.Time
+	author  string
+	snippet string
+}
+
+var channelSummaries []channelSummary
+var channelSummariesMutex sync.Mutex
+
+// addChannelSummary records the last of a channel's messages, which are in
+// the order they are written in. A channel with no messages is recorded
+// with none.
+func addChannelSummary(meta *ChannelMeta, messages []slack.Message, usersMap UsersMap, opts *options) {
+	summary := channelSummary{name: meta.Name, kind: meta.Type}
+	if len(messages) > 0 {
+		last := messages[len(messages)-1]
+		if opts.newestFirst {
+			last = messages[0]
+		}
+		if t := parseTimestamp(last.Timestamp); t != nil {
+			summary.last = *t
+		}
+		summary.author = messageAuthor(last, usersMap, opts)
+		summary.snippet = snippet(slackEntities.Replace(messageText(last, meta, usersMap, opts)))
+	}
+
+	channelSummariesMutex.Lock()
+	channelSummaries = append(channelSummaries, summary)
+	channelSummariesMutex.Unlock()
+}
+
+// snippet returns text on one line, cut to snippetLength characters.
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= snippetLength {
+		return text
+	}
+	return string([]rune(text)[:snippetLength-1]) + "…"
+}
+
+// writeChannelSummary saves summary.csv, which lists each channel dumped
+// with the time, author and beginning of its last message, stalest first,
+// to tell which channels are still in use without opening them.
+func writeChannelSummary(dir string) {
+	if len(channelSummaries) == 0 {
+		return
+	}
+	sort.SliceStable(channelSummaries, func(i, j int) bool {
+		return channelSummaries[i].last.Before(channelSummaries[j].last)
+	})
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"channel", "type", "last_message", "last_author", "last_text"})
+	for _, summary := range channelSummaries {
+		last := ""
+		if !summary.last.IsZero() {
+			last = summary.last.Format(time.RFC3339)
+		}
+		w.Write([]string{summary.name, summary.kind, last, summary.author, summary.snippet})
+	}
+	w.Flush()
+	check(w.Error())
+	err := ioutil.WriteFile(path.Join(dir, "summary.csv"), b.Bytes(), 0644)
+	check(err)
+}
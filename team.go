@@ -0,0 +1,23 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+
+	"github.com/nlopes/slack"
+)
+
+// dumpTeamInfo writes the workspace's name, domain, email domain and icons
+// to team.json, so that an archive can be told apart from those of other
+// workspaces by more than its file name.
+func dumpTeamInfo(api *slack.Client, dir string) {
+	logf("dump team information")
+	sleepBeforeFetchIfNeeded()
+	team, err := api.GetTeamInfo()
+	check(err)
+
+	data, err := MarshalIndent(team, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "team.json"), data, 0644)
+	check(err)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+)
+
+// repliesPageSize is how many replies are asked for per page.
+const repliesPageSize = 200
+
+// fetchReplies fetches the replies of the threads started by messages and
+// returns them, leaving out those already among messages, such as replies
+// also sent to the channel. With --replies-depth only the first replies of
+// each thread are kept.
+func fetchReplies(api *slack.Client, meta *ChannelMeta, messages []slack.Message, opts *options) []slack.Message {
+	seen := make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		seen[msg.Timestamp] = true
+	}
+
+	var replies []slack.Message
+	for _, msg := range messages {
+		if msg.ReplyCount == 0 || msg.ThreadTimestamp != msg.Timestamp || timedOut() {
+			continue
+		}
+
+		limit := repliesPageSize
+		if opts.repliesDepth > 0 && opts.repliesDepth < limit {
+			// The thread's first message comes with its replies.
+			limit = opts.repliesDepth + 1
+		}
+		params := &slack.GetConversationRepliesParameters{ChannelID: meta.ID, Timestamp: msg.Timestamp, Limit: limit}
+		kept := 0
+		for {
+			sleepBeforeFetchIfNeeded()
+			page, hasMore, cursor, err := api.GetConversationReplies(params)
+			check(err)
+			for _, reply := range page {
+				if reply.Timestamp == msg.Timestamp {
+					continue
+				}
+				if opts.repliesDepth > 0 && kept == opts.repliesDepth {
+					break
+				}
+				kept++
+				if !seen[reply.Timestamp] {
+					seen[reply.Timestamp] = true
+					replies = append(replies, reply)
+				}
+			}
+			if !hasMore || cursor == "" || (opts.repliesDepth > 0 && kept == opts.repliesDepth) {
+				break
+			}
+			params.Cursor = cursor
+		}
+		if opts.repliesDepth > 0 && msg.ReplyCount > kept {
+			logf("  %s: kept %d of the %d replies of thread %s", meta.Name, kept, msg.ReplyCount, msg.Timestamp)
+		}
+	}
+	return replies
+}
+
+// threadedMessage is a message in the order the text output shows it, and
+// whether it is shown as a reply under its thread's first message.
+type threadedMessage struct {
+	msg   slack.Message
+	reply bool
+}
+
+// threadOrder orders messages so that each reply follows the first message
+// of its thread, and the replies of a thread keep their order among
+// themselves. Replies whose thread's first message is not among messages
+// stay where they are.
+func threadOrder(messages []slack.Message) []threadedMessage {
+	parents := make(map[string]bool, len(messages))
+	for _, msg := range messages {
+		if msg.ThreadTimestamp == "" || msg.ThreadTimestamp == msg.Timestamp {
+			parents[msg.Timestamp] = true
+		}
+	}
+
+	replies := make(map[string][]slack.Message)
+	for _, msg := range messages {
+		if isReply(msg) && parents[msg.ThreadTimestamp] {
+			replies[msg.ThreadTimestamp] = append(replies[msg.ThreadTimestamp], msg)
+		}
+	}
+
+	ordered := make([]threadedMessage, 0, len(messages))
+	for _, msg := range messages {
+		if isReply(msg) && parents[msg.ThreadTimestamp] {
+			continue
+		}
+		ordered = append(ordered, threadedMessage{msg, false})
+		for _, reply := range replies[msg.Timestamp] {
+			ordered = append(ordered, threadedMessage{reply, true})
+		}
+	}
+	return ordered
+}
+
+// isReply reports whether msg is a reply in a thread, rather than the
+// message that started it.
+func isReply(msg slack.Message) bool {
+	return msg.ThreadTimestamp != "" && msg.ThreadTimestamp != msg.Timestamp
+}
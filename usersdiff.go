@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/nlopes/slack"
+)
+
+// usersDiff is how the users of the workspace changed since an earlier
+// export, as saved in users-diff.json. Users are matched by ID.
+type usersDiff struct {
+	Added   []slack.User  `json:"added"`
+	Removed []slack.User  `json:"removed"`
+	Changed []changedUser `json:"changed"`
+}
+
+// changedUser is a user found in both exports whose details differ.
+type changedUser struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Changes []userChange `json:"changes"`
+}
+
+// userChange is one detail of a user that differs between the exports.
+type userChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// userFields are the details of a user compared between exports, by their
+// names in users.json. A deactivated user shows as deleted going to true.
+var userFields = []struct {
+	name  string
+	value func(u *slack.User) string
+}{
+	{"name", func(u *slack.User) string { return u.Name }},
+	{"real_name", func(u *slack.User) string { return u.RealName }},
+	{"profile.display_name", func(u *slack.User) string { return u.Profile.DisplayName }},
+	{"profile.email", func(u *slack.User) string { return u.Profile.Email }},
+	{"profile.title", func(u *slack.User) string { return u.Profile.Title }},
+	{"deleted", func(u *slack.User) string { return strconv.FormatBool(u.Deleted) }},
+	{"is_bot", func(u *slack.User) string { return strconv.FormatBool(u.IsBot) }},
+	{"is_admin", func(u *slack.User) string { return strconv.FormatBool(u.IsAdmin) }},
+	{"is_owner", func(u *slack.User) string { return strconv.FormatBool(u.IsOwner) }},
+	{"is_primary_owner", func(u *slack.User) string { return strconv.FormatBool(u.IsPrimaryOwner) }},
+	{"is_restricted", func(u *slack.User) string { return strconv.FormatBool(u.IsRestricted) }},
+	{"is_ultra_restricted", func(u *slack.User) string { return strconv.FormatBool(u.IsUltraRestricted) }},
+}
+
+// readUsersFile reads the users.json of an earlier export.
+func readUsersFile(name string) ([]slack.User, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	users := []slack.User{}
+	err = json.Unmarshal(data, &users)
+	return users, err
+}
+
+// diffUsers compares the users of an earlier export with those of now.
+func diffUsers(previous, current []slack.User) usersDiff {
+	diff := usersDiff{Added: []slack.User{}, Removed: []slack.User{}, Changed: []changedUser{}}
+
+	before := make(map[string]*slack.User, len(previous))
+	for i := range previous {
+		before[previous[i].ID] = &previous[i]
+	}
+	now := make(map[string]bool, len(current))
+	for i := range current {
+		user := &current[i]
+		now[user.ID] = true
+		old, ok := before[user.ID]
+		if !ok {
+			diff.Added = append(diff.Added, *user)
+			continue
+		}
+		var changes []userChange
+		for _, field := range userFields {
+			if a, b := field.value(old), field.value(user); a != b {
+				changes = append(changes, userChange{field.name, a, b})
+			}
+		}
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, changedUser{user.ID, user.Name, changes})
+		}
+	}
+	for _, user := range previous {
+		if !now[user.ID] {
+			diff.Removed = append(diff.Removed, user)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Name < diff.Added[j].Name })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Name < diff.Removed[j].Name })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+	return diff
+}
+
+// writeUsersDiff saves how users changed since the earlier export to
+// users-diff.json.
+func writeUsersDiff(dir string, previous, current []slack.User) {
+	diff := diffUsers(previous, current)
+	logf("  users since the previous export: %d added, %d removed, %d changed",
+		len(diff.Added), len(diff.Removed), len(diff.Changed))
+	data, err := MarshalIndent(diff, "", "    ")
+	check(err)
+	err = ioutil.WriteFile(path.Join(dir, "users-diff.json"), data, 0644)
+	check(err)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// exportSchemaJSON describes the files of a Slack export: users.json,
+// channels.json and the per-channel message files.
+//
+//go:embed export_schema.json
+var exportSchemaJSON []byte
+
+// schema is the subset of JSON Schema used by export_schema.json.
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+}
+
+type exportSchema struct {
+	Definitions map[string]*schema `json:"definitions"`
+}
+
+// validateExport checks the files written to dir against the embedded
+// export schema and records every mismatch as a warning.
+func validateExport(dir string) {
+	logf("validate export")
+	var es exportSchema
+	check(json.Unmarshal(exportSchemaJSON, &es))
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		var def string
+		switch {
+		case rel == "users.json":
+			def = "users"
+		case rel == "channels.json":
+			def = "channels"
+		case isMessageFile(rel):
+			def = "messages"
+		default:
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			addWarning("%s is not valid JSON: %v", rel, err)
+			return nil
+		}
+
+		// The same problem usually repeats for every element of an array.
+		problems := make(map[string]int)
+		es.validate(es.Definitions[def], v, "", func(problem string) {
+			problems[problem]++
+		})
+		var sorted []string
+		for problem := range problems {
+			sorted = append(sorted, problem)
+		}
+		sort.Strings(sorted)
+		for _, problem := range sorted {
+			addWarning("%s does not match the Slack export format: %s (%d times)", rel, problem, problems[problem])
+		}
+		return nil
+	})
+	check(err)
+}
+
+// isMessageFile reports whether the file at rel, relative to the export, is
+// the JSON message file of a conversation, rather than one of the other
+// files kept next to them or a downloaded file.
+func isMessageFile(rel string) bool {
+	for _, suffix := range []string{".events.json", ".bookmarks.json", ".membership.json", ".discord.json"} {
+		if strings.HasSuffix(rel, suffix) {
+			return false
+		}
+	}
+	dir := filepath.Dir(rel)
+	return filepath.Ext(rel) == ".json" && dir != "." && dir != "files"
+}
+
+func (es *exportSchema) validate(s *schema, v interface{}, at string, report func(string)) {
+	if s.Ref != "" {
+		s = es.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	if !s.allows(v) {
+		report(fmt.Sprintf("%s should be of type %s", describePath(at), s.Type))
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				report(describePath(at+"."+name) + " is missing")
+			}
+		}
+		for name, prop := range s.Properties {
+			if field, ok := v[name]; ok {
+				es.validate(prop, field, at+"."+name, report)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for _, item := range v {
+				es.validate(s.Items, item, at+"[]", report)
+			}
+		}
+	}
+}
+
+// allows reports whether v, as decoded by encoding/json, has the schema's type.
+func (s *schema) allows(v interface{}) bool {
+	switch s.Type {
+	case "":
+		return true
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func describePath(at string) string {
+	if at == "" {
+		return "the top level"
+	}
+	return strings.TrimPrefix(at, ".")
+}